@@ -3,52 +3,222 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/mattermost/mattermost/server/public/model"
 )
 
 var (
 	// accountsFile is the json file that contains all accounts
 	accountsFile = "accounts.json"
 
+	// accountsDir is the directory that contains the account directories
+	// with the state of each account
+	accountsDir = "accounts"
+
 	// accounts contains all active accounts
 	accounts = make(map[int]*account)
+
+	// accountsMutex protects accounts from concurrent client commands
+	accountsMutex sync.Mutex
 )
 
-// account stores account information
+// account stores account information; the ID identifies the account in
+// client commands and may be reused after the account is removed, the
+// Identity is unique and identifies the account directory
 type account struct {
 	ID       int
+	Identity string `json:",omitempty"`
+	Name     string `json:",omitempty"`
 	Protocol string
 	User     string
+	Login    string `json:",omitempty"`
+	Server   string `json:",omitempty"`
 	Password string
+	Settings accountSettings `json:",omitzero"`
+	Disabled bool            `json:",omitempty"`
 
 	client *mattermost
 }
 
-// splitAccountUser extracts username and server address from the account user
-func (a *account) splitAccountUser() (username, server string) {
-	username = strings.Split(a.User, "@")[0]
-	server = strings.Split(a.User, "@")[1]
-	return
+// parseAccountUser splits the account user "<login>@<server>" at the last
+// "@" into the login name and the server; the server is an address, e.g.,
+// "chat.example.com:8065", or an url with an optional subpath, e.g.,
+// "https://chat.example.com/mattermost"
+func parseAccountUser(user string) (login, server string, err error) {
+	i := strings.LastIndex(user, "@")
+	if i < 1 || i == len(user)-1 {
+		return "", "", fmt.Errorf("invalid user %s, expected "+
+			"<login>@<server>", user)
+	}
+	login, server = user[:i], user[i+1:]
+
+	// parse server address as url without scheme
+	raw := server
+	if !strings.Contains(raw, "://") {
+		raw = "//" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid server %s", server)
+	}
+	if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" {
+		return "", "", fmt.Errorf("unsupported server scheme %s",
+			u.Scheme)
+	}
+	if u.Host == "" || u.User != nil || u.RawQuery != "" ||
+		u.Fragment != "" {
+		return "", "", fmt.Errorf("invalid server %s", server)
+	}
+	return login, strings.TrimSuffix(server, "/"), nil
+}
+
+// getServerHost returns the host of the server address or url
+func getServerHost(server string) string {
+	raw := server
+	if !strings.Contains(raw, "://") {
+		raw = "//" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return server
+	}
+	return u.Host
+}
+
+// checkAccountName checks if name is a valid account name; account names
+// are shown in account messages and must not contain spaces
+func checkAccountName(name string) error {
+	if name == "" || strings.ContainsFunc(name, unicode.IsSpace) {
+		return fmt.Errorf("invalid account name %q, expected a name "+
+			"without spaces", name)
+	}
+	return nil
+}
+
+// getServerURLs returns the http and websocket urls of the server; if the
+// server has no scheme, https is used unless disableEncryption is set
+func getServerURLs(server string, disableEncryption bool) (httpURL,
+	webSocketURL string) {
+
+	scheme, address, found := strings.Cut(server, "://")
+	if !found {
+		address = server
+		scheme = "https"
+		if disableEncryption {
+			scheme = "http"
+		}
+	}
+	if scheme == "http" {
+		return "http://" + address, "ws://" + address
+	}
+	return "https://" + address, "wss://" + address
 }
 
 // start starts the client for this account
 func (a *account) start(ctx context.Context) {
-	// skip non-mattermost accounts
+	// skip non-mattermost and disabled accounts
 	if a.Protocol != "mattermost" {
 		return
 	}
+	if a.Disabled {
+		logInfo("Account", a.ID, "is disabled")
+		return
+	}
 
-	// extract server and username from account user
-	user, server := a.splitAccountUser()
+	// accounts from old account files only have a user, extract login
+	// name and server from it
+	if a.Server == "" {
+		login, server, err := parseAccountUser(a.User)
+		if err != nil {
+			logError("account", a.ID, err)
+			return
+		}
+		a.Login, a.Server = login, server
+	}
 
-	// start client
+	// start client; if the TLS or proxy settings are invalid or the
+	// account directory cannot be created, the account stays offline
 	logInfo("Starting account", a.ID)
-	a.client = newClient(conf, a.ID, server, user, a.Password)
-	go a.client.run(ctx)
+	settings := a.Settings.getClientSettings(conf)
+	tlsConfig, tlsErr := a.Settings.TLS.getConfig()
+	proxy, proxyErr := getProxy(a.Settings.getProxy(conf))
+	dirErr := os.MkdirAll(a.getDir(), 0700)
+	a.client = newClient(settings, a.ID, a.getDir(), a.Server, a.Login,
+		a.Password, tlsConfig, proxy)
+	if err := errors.Join(tlsErr, proxyErr, dirErr); err != nil {
+		a.client.setLastError(err)
+		return
+	}
+	a.client.start(ctx)
+}
+
+// getName returns the name of this account; if the account has no name, it
+// returns the name derived from the server and teams after login or the
+// server host
+func (a *account) getName() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	if a.client != nil {
+		if name := a.client.getName(); name != "" {
+			return name
+		}
+	}
+	if a.Server != "" {
+		return getServerHost(a.Server)
+	}
+	return "()"
+}
+
+// getDir returns the account directory that contains the state of this
+// account
+func (a *account) getDir() string {
+	return filepath.Join(conf.Dir, accountsDir, a.Identity)
+}
+
+// initIdentity sets the identity of accounts from old account files and
+// moves their old channels file into the account directory; it returns
+// whether the account was changed
+func (a *account) initIdentity() bool {
+	if a.Identity != "" {
+		return false
+	}
+	a.Identity = model.NewId()
+
+	oldFile := filepath.Join(conf.Dir, fmt.Sprintf("channels%d.json", a.ID))
+	if _, err := os.Stat(oldFile); err != nil {
+		return true
+	}
+	logInfo("Moving", oldFile, "to account directory of account", a.ID)
+	if err := os.MkdirAll(a.getDir(), 0700); err != nil {
+		logError(err)
+		return true
+	}
+	err := os.Rename(oldFile, filepath.Join(a.getDir(), channelsFile))
+	if err != nil {
+		logError(err)
+	}
+	return true
+}
+
+// removeDir removes the account directory with the state of this account
+func (a *account) removeDir() {
+	if a.Identity == "" {
+		return
+	}
+	if err := os.RemoveAll(a.getDir()); err != nil {
+		logError(err)
+	}
 }
 
 // stop shuts down the client for this account
@@ -59,13 +229,158 @@ func (a *account) stop() {
 	}
 }
 
-// getAccount returns account with account ID
+// restart stops the client of this account and starts a new client unless
+// the account is disabled
+func (a *account) restart(ctx context.Context) {
+	a.stop()
+	a.client = nil
+	a.start(ctx)
+}
+
+// setUser sets the user of this account; the user of mattermost accounts
+// must be valid
+func (a *account) setUser(user string) error {
+	if a.Protocol == "mattermost" {
+		login, server, err := parseAccountUser(user)
+		if err != nil {
+			return err
+		}
+		a.Login, a.Server = login, server
+	}
+	a.User = user
+	return nil
+}
+
+// getSettingValue returns the value of the account setting of the account
+// and whether it is the global default
+func (a *account) getSettingValue(setting *accountSetting) (string, bool) {
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+	if value, ok := setting.get(&a.Settings); ok {
+		return value, false
+	}
+	return setting.def(conf), true
+}
+
+// updateAccount calls update with the account identified by id; if update
+// succeeds, it saves the accounts and restarts the account so the changes
+// take effect
+func updateAccount(ctx context.Context, id int, update func(a *account) error) error {
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+
+	a := accounts[id]
+	if a == nil {
+		return fmt.Errorf("unknown account %d", id)
+	}
+	if err := update(a); err != nil {
+		return err
+	}
+	writeAccountsToFile()
+	a.restart(ctx)
+	return nil
+}
+
+// setAccountSetting sets the account setting identified by key of the
+// account with id to value
+func setAccountSetting(ctx context.Context, id int, key, value string) error {
+	setting, err := getAccountSetting(key)
+	if err != nil {
+		return err
+	}
+	return updateAccount(ctx, id, func(a *account) error {
+		return setting.set(&a.Settings, value)
+	})
+}
+
+// setAccountName sets the name of the account with id; the name "default"
+// resets the name to the name derived from the server and teams
+func setAccountName(id int, name string) error {
+	if name == settingDefault {
+		name = ""
+	} else if err := checkAccountName(name); err != nil {
+		return err
+	}
+
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+
+	a := accounts[id]
+	if a == nil {
+		return fmt.Errorf("unknown account %d", id)
+	}
+	a.Name = name
+	writeAccountsToFile()
+	return nil
+}
+
+// editAccount sets the field name, user or password of the account with id
+// to value; the account is restarted unless only its name changes
+func editAccount(ctx context.Context, id int, field, value string) error {
+	if field == "name" {
+		return setAccountName(id, value)
+	}
+	return updateAccount(ctx, id, func(a *account) error {
+		switch field {
+		case "user":
+			return a.setUser(value)
+		case "password":
+			a.Password = value
+			return nil
+		}
+		return fmt.Errorf("unknown field %s, expected name, user or "+
+			"password", field)
+	})
+}
+
+// setAccountDisabled disables or enables the account with id; disabled
+// accounts are kept but not connected
+func setAccountDisabled(ctx context.Context, id int, disabled bool) error {
+	return updateAccount(ctx, id, func(a *account) error {
+		a.Disabled = disabled
+		return nil
+	})
+}
+
+// reconnectAccount reconnects the account with id
+func reconnectAccount(ctx context.Context, id int) error {
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+
+	a := accounts[id]
+	if a == nil {
+		return fmt.Errorf("unknown account %d", id)
+	}
+	if a.Disabled {
+		return fmt.Errorf("account %d is disabled", id)
+	}
+	a.restart(ctx)
+	return nil
+}
+
+// copy returns a copy of the account; it must be called with accountsMutex
+// held, the copy can be used without it, e.g., while the account is restarted
+// and its client is replaced
+func (a *account) copy() *account {
+	if a == nil {
+		return nil
+	}
+	c := *a
+	return &c
+}
+
+// getAccount returns a copy of the account with account ID
 func getAccount(id int) *account {
-	return accounts[id]
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+	return accounts[id].copy()
 }
 
-// getAccounts returns all accounts sorted by account ID
+// getAccounts returns copies of all accounts sorted by account ID
 func getAccounts() []*account {
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+
 	// sort account ids
 	ids := make([]int, len(accounts))
 	i := 0
@@ -78,7 +393,7 @@ func getAccounts() []*account {
 	// construct sorted slice of accounts
 	accs := make([]*account, len(accounts))
 	for i, id := range ids {
-		accs[i] = accounts[id]
+		accs[i] = accounts[id].copy()
 	}
 	return accs
 }
@@ -93,27 +408,47 @@ func getFreeAccountID() int {
 	return len(accounts)
 }
 
-// addAccount adds a new account with protocol, user and password and returns
-// the new account's ID
-func addAccount(ctx context.Context, protocol, user, password string) int {
+// addAccount adds a new account with protocol, user, password and optional
+// name and returns the new account's ID; the user of mattermost accounts must
+// be valid
+func addAccount(ctx context.Context, protocol, user, password,
+	name string) (int, error) {
+
 	a := account{
-		ID:       getFreeAccountID(),
+		Identity: model.NewId(),
+		Name:     name,
 		Protocol: protocol,
-		User:     user,
 		Password: password,
 	}
+	if err := a.setUser(user); err != nil {
+		return 0, err
+	}
+	if name != "" {
+		if err := checkAccountName(name); err != nil {
+			return 0, err
+		}
+	}
+
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+
+	a.ID = getFreeAccountID()
 	accounts[a.ID] = &a
 	writeAccountsToFile()
 	a.start(ctx)
-	return a.ID
+	return a.ID, nil
 }
 
 // delAccount removes the existing account with id
 func delAccount(id int) bool {
-	if accounts[id] != nil {
-		accounts[id].stop()
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+
+	if a := accounts[id]; a != nil {
+		a.stop()
 		delete(accounts, id)
 		writeAccountsToFile()
+		a.removeDir()
 		return true
 	}
 	return false
@@ -144,25 +479,33 @@ func readAccountsFromFile() {
 
 		accounts[a.ID] = &a
 	}
+
+	// give accounts from old account files an identity
+	changed := false
+	for _, a := range accounts {
+		if a.initIdentity() {
+			changed = true
+		}
+	}
+	if changed {
+		writeAccountsToFile()
+	}
 }
 
-// writeAccountsToFile writes all accounts to file
+// writeAccountsToFile writes all accounts to file; the accounts are written
+// to a temporary file that replaces the file, so the old accounts are not
+// lost if writing fails
 func writeAccountsToFile() {
 	file := filepath.Join(conf.Dir, accountsFile)
 
-	// open file for writing
-	f, err := os.Create(file)
-	if err != nil {
-		logFatal(err)
-	}
-
-	// make sure file is only readable and writable by the current user
-	err = os.Chmod(file, 0600)
+	// open temporary file for writing, it is only readable and writable
+	// by the current user
+	f, err := os.CreateTemp(conf.Dir, accountsFile+".*")
 	if err != nil {
 		logFatal(err)
 	}
 
-	// write accounts to file
+	// write accounts to temporary file
 	enc := json.NewEncoder(f)
 	for _, a := range accounts {
 		err := enc.Encode(&a)
@@ -170,6 +513,17 @@ func writeAccountsToFile() {
 			logFatal(err)
 		}
 	}
+	if err := f.Sync(); err != nil {
+		logFatal(err)
+	}
+	if err := f.Close(); err != nil {
+		logFatal(err)
+	}
+
+	// replace file
+	if err := os.Rename(f.Name(), file); err != nil {
+		logFatal(err)
+	}
 }
 
 // startAccounts initializes all accounts and starts their clients
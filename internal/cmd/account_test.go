@@ -2,28 +2,102 @@ package cmd
 
 import (
 	"context"
-	"slices"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
-func TestSplitAccountUser(t *testing.T) {
-	a := account{
-		User: "testuser@testserver.com:8065",
+func TestParseAccountUser(t *testing.T) {
+	// test valid users
+	for _, test := range []struct {
+		user, login, server string
+	}{
+		{"testuser@testserver.com:8065", "testuser",
+			"testserver.com:8065"},
+		{"me@corp.com@chat.corp.com", "me@corp.com", "chat.corp.com"},
+		{"testuser@https://chat.example.com/mattermost/", "testuser",
+			"https://chat.example.com/mattermost"},
+		{"testuser@http://localhost:8065", "testuser",
+			"http://localhost:8065"},
+	} {
+		login, server, err := parseAccountUser(test.user)
+		if err != nil || login != test.login || server != test.server {
+			t.Errorf("got %s %s %v, wanted %s %s", login, server,
+				err, test.login, test.server)
+		}
 	}
-	username, server := a.splitAccountUser()
 
-	// check username
-	want := "testuser"
-	got := username
-	if got != want {
-		t.Errorf("got %s, wanted %s", got, want)
+	// test invalid users
+	for _, user := range []string{
+		"testuser",
+		"@testserver.com",
+		"testuser@",
+		"testuser@ftp://testserver.com",
+		"testuser@https://",
+		"testuser@testserver.com?test",
+	} {
+		if _, _, err := parseAccountUser(user); err == nil {
+			t.Errorf("%s: got nil, wanted error", user)
+		}
 	}
+}
 
-	// check server address
-	want = "testserver.com:8065"
-	got = server
-	if got != want {
-		t.Errorf("got %s, wanted %s", got, want)
+func TestGetServerURLs(t *testing.T) {
+	for _, test := range []struct {
+		server            string
+		disableEncryption bool
+		httpURL, wsURL    string
+	}{
+		{"chat.example.com", false, "https://chat.example.com",
+			"wss://chat.example.com"},
+		{"chat.example.com", true, "http://chat.example.com",
+			"ws://chat.example.com"},
+		{"https://chat.example.com/mm", true,
+			"https://chat.example.com/mm",
+			"wss://chat.example.com/mm"},
+		{"http://localhost:8065", false, "http://localhost:8065",
+			"ws://localhost:8065"},
+	} {
+		httpURL, wsURL := getServerURLs(test.server,
+			test.disableEncryption)
+		if httpURL != test.httpURL || wsURL != test.wsURL {
+			t.Errorf("got %s %s, wanted %s %s", httpURL, wsURL,
+				test.httpURL, test.wsURL)
+		}
+	}
+}
+
+func TestCheckAccountName(t *testing.T) {
+	for _, name := range []string{"work", "chat.example.com/team"} {
+		if err := checkAccountName(name); err != nil {
+			t.Errorf("%s: got %v, wanted nil", name, err)
+		}
+	}
+	for _, name := range []string{"", "my work", "work\t"} {
+		if err := checkAccountName(name); err == nil {
+			t.Errorf("%q: got nil, wanted error", name)
+		}
+	}
+}
+
+func TestAccountGetName(t *testing.T) {
+	for _, test := range []struct {
+		a    *account
+		want string
+	}{
+		{&account{Name: "work", Server: "chat.example.com"}, "work"},
+		{&account{Server: "https://chat.example.com/mm"},
+			"chat.example.com"},
+		{&account{Server: "chat.example.com", client: &mattermost{
+			name: "chat.example.com/team"}},
+			"chat.example.com/team"},
+		{&account{Protocol: "test"}, "()"},
+	} {
+		got := test.a.getName()
+		if got != test.want {
+			t.Errorf("got %s, wanted %s", got, test.want)
+		}
 	}
 }
 
@@ -55,20 +129,20 @@ func TestGetAccount(t *testing.T) {
 	// test existing entries
 	want = accounts[0]
 	got = getAccount(0)
-	if got != want {
-		t.Errorf("got %p, wanted %p", got, want)
+	if got == nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
 	}
 
 	want = accounts[1]
 	got = getAccount(1)
-	if got != want {
-		t.Errorf("got %p, wanted %p", got, want)
+	if got == nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
 	}
 
 	want = accounts[2]
 	got = getAccount(2)
-	if got != want {
-		t.Errorf("got %p, wanted %p", got, want)
+	if got == nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
 	}
 
 	// test non existing entry
@@ -94,7 +168,7 @@ func TestGetAccounts(t *testing.T) {
 	want := []*account{accounts[0], accounts[1], accounts[2]}
 	got := getAccounts()
 
-	if !slices.Equal(got, want) {
+	if !reflect.DeepEqual(got, want) {
 		t.Errorf("got %v, wanted %v", got, want)
 	}
 }
@@ -159,7 +233,11 @@ func TestAddAccount(t *testing.T) {
 	protocol := "test"
 	user := "testuser"
 	password := "testpasswd"
-	id := addAccount(context.Background(), protocol, user, password)
+	id, err := addAccount(context.Background(), protocol, user, password,
+		"")
+	if err != nil {
+		t.Fatal(err)
+	}
 	a := getAccount(id)
 
 	// test id
@@ -181,6 +259,30 @@ func TestAddAccount(t *testing.T) {
 	if a.Password != password {
 		t.Errorf("got %s, wanted %s", a.Password, password)
 	}
+
+	// test invalid mattermost account
+	_, err = addAccount(context.Background(), "mattermost", "testuser",
+		password, "")
+	if err == nil {
+		t.Errorf("got nil, wanted error")
+	}
+
+	// test account with name
+	id, err = addAccount(context.Background(), protocol, user, password,
+		"work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := getAccount(id).Name; got != "work" {
+		t.Errorf("got %s, wanted work", got)
+	}
+
+	// test invalid name
+	_, err = addAccount(context.Background(), protocol, user, password,
+		"my work")
+	if err == nil {
+		t.Errorf("got nil, wanted error")
+	}
 }
 
 func TestDelAccount(t *testing.T) {
@@ -196,7 +298,18 @@ func TestDelAccount(t *testing.T) {
 	conf.Dir = dir
 
 	// add dummy account
-	id := addAccount(context.Background(), "test", "testuser", "testpasswd")
+	id, err := addAccount(context.Background(), "test", "testuser",
+		"testpasswd", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// create account directory
+	a := getAccount(id)
+	if err := os.MkdirAll(a.getDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	newChannels(a.getDir()).updatePostID("channelID", "postID")
 
 	// test deleting dummy account
 	delAccount(id)
@@ -206,6 +319,23 @@ func TestDelAccount(t *testing.T) {
 	if got != want {
 		t.Errorf("got %p, wanted %p", got, want)
 	}
+
+	// test removing account directory
+	if _, err := os.Stat(a.getDir()); !os.IsNotExist(err) {
+		t.Errorf("got %v, wanted not exist error", err)
+	}
+
+	// test new account with the same id gets a new identity
+	id, err = addAccount(context.Background(), "test", "testuser",
+		"testpasswd", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := getAccount(id)
+	if b.ID != a.ID || b.Identity == a.Identity {
+		t.Errorf("got %d %s, wanted %d and new identity", b.ID,
+			b.Identity, a.ID)
+	}
 }
 
 func TestReadAccountsFromFile(t *testing.T) {
@@ -224,7 +354,11 @@ func TestReadAccountsFromFile(t *testing.T) {
 	protocol := "test"
 	user := "testuser"
 	password := "testpasswd"
-	id := addAccount(context.Background(), protocol, user, password)
+	id, err := addAccount(context.Background(), protocol, user, password,
+		"")
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// reset accounts
 	accounts = make(map[int]*account)
@@ -254,6 +388,102 @@ func TestReadAccountsFromFile(t *testing.T) {
 	}
 }
 
+func TestWriteAccountsToFile(t *testing.T) {
+	// reset accounts
+	accounts = make(map[int]*account)
+	defer func() {
+		// cleanup
+		accounts = make(map[int]*account)
+	}()
+
+	// configure working directory
+	dir := t.TempDir()
+	conf.Dir = dir
+
+	// test replacing existing file
+	file := filepath.Join(dir, accountsFile)
+	err := os.WriteFile(file, []byte(`{"ID":3,"Protocol":"test"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts[1] = &account{ID: 1, Protocol: "test", Password: "secret"}
+	writeAccountsToFile()
+
+	// test permissions
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("got %o, wanted 600", perm)
+	}
+
+	// test no temporary files
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files, wanted 1", len(entries))
+	}
+
+	// test written accounts
+	accounts = make(map[int]*account)
+	readAccountsFromFile()
+	if a := getAccount(1); a == nil || a.Password != "secret" ||
+		getAccount(3) != nil {
+		t.Errorf("got %v, wanted only account 1", getAccounts())
+	}
+}
+
+func TestReadAccountsFromFileMigrate(t *testing.T) {
+	// reset accounts
+	accounts = make(map[int]*account)
+	defer func() {
+		// cleanup
+		accounts = make(map[int]*account)
+	}()
+
+	// configure working directory
+	dir := t.TempDir()
+	conf.Dir = dir
+
+	// create old account and channels files without identity
+	err := os.WriteFile(filepath.Join(dir, accountsFile),
+		[]byte(`{"ID":3,"Protocol":"test","User":"testuser"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldFile := filepath.Join(dir, "channels3.json")
+	err = os.WriteFile(oldFile, []byte(`{"channelID":"postID"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// test reading and migrating accounts
+	readAccountsFromFile()
+	a := getAccount(3)
+	if a.Identity == "" {
+		t.Fatal("got empty identity, wanted identity")
+	}
+	if _, err := os.Stat(oldFile); !os.IsNotExist(err) {
+		t.Errorf("got %v, wanted not exist error", err)
+	}
+	want := "postID"
+	got := newChannels(a.getDir()).getPostID("channelID")
+	if got != want {
+		t.Errorf("got %s, wanted %s", got, want)
+	}
+
+	// test saving the identity
+	identity := a.Identity
+	accounts = make(map[int]*account)
+	readAccountsFromFile()
+	if got := getAccount(3).Identity; got != identity {
+		t.Errorf("got %s, wanted %s", got, identity)
+	}
+}
+
 func TestStartStopAccounts(t *testing.T) {
 	// reset accounts
 	accounts = make(map[int]*account)
@@ -268,9 +498,9 @@ func TestStartStopAccounts(t *testing.T) {
 
 	// add dummy accounts
 	ctx := context.Background()
-	addAccount(ctx, "test", "testuser1", "testpasswd1")
-	addAccount(ctx, "test", "testuser2", "testpasswd2")
-	addAccount(ctx, "test", "testuser3", "testpasswd3")
+	addAccount(ctx, "test", "testuser1", "testpasswd1", "")
+	addAccount(ctx, "test", "testuser2", "testpasswd2", "")
+	addAccount(ctx, "test", "testuser3", "testpasswd3", "")
 
 	// reset accounts
 	accounts = make(map[int]*account)
@@ -279,3 +509,204 @@ func TestStartStopAccounts(t *testing.T) {
 	startAccounts(ctx)
 	stopAccounts()
 }
+
+func TestSetAccountSetting(t *testing.T) {
+	// reset accounts
+	accounts = make(map[int]*account)
+	defer func() {
+		// cleanup
+		accounts = make(map[int]*account)
+	}()
+
+	// configure working directory
+	dir := t.TempDir()
+	conf.Dir = dir
+
+	// add dummy account
+	ctx := context.Background()
+	id, err := addAccount(ctx, "test", "testuser", "testpasswd", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setting, err := getAccountSetting("filter_own")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// test setting and saving the setting
+	if err := setAccountSetting(ctx, id, "filter_own", "true"); err != nil {
+		t.Fatal(err)
+	}
+	a := getAccount(id)
+	value, isDefault := a.getSettingValue(setting)
+	if value != "true" || isDefault {
+		t.Errorf("got %s %t, wanted true false", value, isDefault)
+	}
+	accounts = make(map[int]*account)
+	readAccountsFromFile()
+	a = getAccount(id)
+	if a.Settings.FilterOwn == nil || !*a.Settings.FilterOwn {
+		t.Errorf("got %v, wanted true", a.Settings.FilterOwn)
+	}
+
+	// test resetting the setting
+	if err := setAccountSetting(ctx, id, "filter_own",
+		settingDefault); err != nil {
+		t.Fatal(err)
+	}
+	a = getAccount(id)
+	value, isDefault = a.getSettingValue(setting)
+	if value != "false" || !isDefault {
+		t.Errorf("got %s %t, wanted false true", value, isDefault)
+	}
+
+	// test errors
+	for _, test := range []struct {
+		id         int
+		key, value string
+	}{
+		{id + 1, "filter_own", "true"},
+		{id, "unknown", "true"},
+		{id, "filter_own", "maybe"},
+	} {
+		if err := setAccountSetting(ctx, test.id, test.key,
+			test.value); err == nil {
+			t.Errorf("%v: got nil, wanted error", test)
+		}
+	}
+}
+
+func TestEditAccount(t *testing.T) {
+	// reset accounts
+	accounts = make(map[int]*account)
+	defer func() {
+		// cleanup
+		accounts = make(map[int]*account)
+	}()
+
+	// configure working directory
+	dir := t.TempDir()
+	conf.Dir = dir
+
+	// add dummy accounts
+	ctx := context.Background()
+	id, err := addAccount(ctx, "test", "testuser", "testpasswd", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mmID, err := addAccount(ctx, "mattermost", "user@server", "passwd",
+		"")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts[mmID].Disabled = true
+
+	// test editing and saving the fields
+	if err := editAccount(ctx, id, "user", "otheruser"); err != nil {
+		t.Fatal(err)
+	}
+	if err := editAccount(ctx, id, "password", "otherpasswd"); err != nil {
+		t.Fatal(err)
+	}
+	if err := editAccount(ctx, mmID, "user",
+		"other@https://example.com"); err != nil {
+		t.Fatal(err)
+	}
+	accounts = make(map[int]*account)
+	readAccountsFromFile()
+	a := getAccount(id)
+	if a.User != "otheruser" || a.Password != "otherpasswd" {
+		t.Errorf("got %s %s, wanted otheruser otherpasswd", a.User,
+			a.Password)
+	}
+	a = getAccount(mmID)
+	if a.Login != "other" || a.Server != "https://example.com" {
+		t.Errorf("got %s %s, wanted other https://example.com",
+			a.Login, a.Server)
+	}
+
+	// test editing and resetting the name
+	if err := editAccount(ctx, id, "name", "work"); err != nil {
+		t.Fatal(err)
+	}
+	accounts = make(map[int]*account)
+	readAccountsFromFile()
+	if got := getAccount(id).Name; got != "work" {
+		t.Errorf("got %s, wanted work", got)
+	}
+	if err := editAccount(ctx, id, "name", settingDefault); err != nil {
+		t.Fatal(err)
+	}
+	if got := getAccount(id).Name; got != "" {
+		t.Errorf("got %s, wanted empty name", got)
+	}
+
+	// test errors
+	for _, test := range []struct {
+		id           int
+		field, value string
+	}{
+		{mmID + 1, "user", "testuser"},
+		{mmID + 1, "name", "work"},
+		{id, "unknown", "test"},
+		{id, "name", "my work"},
+		{mmID, "user", "invalid"},
+	} {
+		if err := editAccount(ctx, test.id, test.field,
+			test.value); err == nil {
+			t.Errorf("%v: got nil, wanted error", test)
+		}
+	}
+}
+
+func TestSetAccountDisabled(t *testing.T) {
+	// reset accounts
+	accounts = make(map[int]*account)
+	defer func() {
+		// cleanup
+		accounts = make(map[int]*account)
+	}()
+
+	// configure working directory
+	dir := t.TempDir()
+	conf.Dir = dir
+
+	// add dummy account
+	ctx := context.Background()
+	id, err := addAccount(ctx, "test", "testuser", "testpasswd", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// test disabling and saving the account
+	if err := setAccountDisabled(ctx, id, true); err != nil {
+		t.Fatal(err)
+	}
+	accounts = make(map[int]*account)
+	readAccountsFromFile()
+	if got := getAccount(id).Disabled; !got {
+		t.Errorf("got %t, wanted true", got)
+	}
+	if err := reconnectAccount(ctx, id); err == nil {
+		t.Errorf("got nil, wanted error")
+	}
+
+	// test enabling the account
+	if err := setAccountDisabled(ctx, id, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := getAccount(id).Disabled; got {
+		t.Errorf("got %t, wanted false", got)
+	}
+	if err := reconnectAccount(ctx, id); err != nil {
+		t.Errorf("got %v, wanted nil", err)
+	}
+
+	// test errors
+	if err := setAccountDisabled(ctx, id+1, true); err == nil {
+		t.Errorf("got nil, wanted error")
+	}
+	if err := reconnectAccount(ctx, id+1); err == nil {
+		t.Errorf("got nil, wanted error")
+	}
+}
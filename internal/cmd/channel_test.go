@@ -10,7 +10,7 @@ func TestChannelsGetPostID(t *testing.T) {
 	conf.Dir = dir
 
 	// create channels
-	c := newChannels(0)
+	c := newChannels(dir)
 
 	// get non-existent channel/post id
 	want := ""
@@ -34,7 +34,7 @@ func TestChannelsUpdatePostID(t *testing.T) {
 	conf.Dir = dir
 
 	// create channels
-	c := newChannels(0)
+	c := newChannels(dir)
 
 	// set channel/post id
 	c.updatePostID("channelID", "postID")
@@ -59,7 +59,7 @@ func TestChannelsDeleteChannel(t *testing.T) {
 	conf.Dir = dir
 
 	// create channels
-	c := newChannels(0)
+	c := newChannels(dir)
 
 	// set channel/post id
 	c.updatePostID("channelID", "postID")
@@ -93,7 +93,7 @@ func TestChannelsReadFromFile(t *testing.T) {
 	conf.Dir = dir
 
 	// create channels
-	c := newChannels(0)
+	c := newChannels(dir)
 
 	// test read empty
 	c.readFromFile()
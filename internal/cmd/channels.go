@@ -2,12 +2,17 @@ package cmd
 
 import (
 	"encoding/json"
-	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 )
 
+var (
+	// channelsFile is the json file in the account directory that
+	// contains the last known post ids of joined channels
+	channelsFile = "channels.json"
+)
+
 // channels stores information about joined channels
 type channels struct {
 	postIDs  map[string]string
@@ -35,7 +40,7 @@ func (c *channels) deleteChannel(chanID string) {
 
 // readFromFile reads channels from file
 func (c *channels) readFromFile() {
-	file := filepath.Join(conf.Dir, c.fileName)
+	file := c.fileName
 
 	// open file for reading
 	f, err := os.Open(file)
@@ -59,7 +64,7 @@ func (c *channels) readFromFile() {
 
 // writeToFile writes channels to file
 func (c *channels) writeToFile() {
-	file := filepath.Join(conf.Dir, c.fileName)
+	file := c.fileName
 
 	// open file for writing
 	f, err := os.Create(file)
@@ -81,10 +86,11 @@ func (c *channels) writeToFile() {
 	}
 }
 
-func newChannels(accountID int) *channels {
+// newChannels creates channels stored in the account directory dir
+func newChannels(dir string) *channels {
 	c := channels{
 		postIDs:  make(map[string]string),
-		fileName: fmt.Sprintf("channels%d.json", accountID),
+		fileName: filepath.Join(dir, channelsFile),
 	}
 	c.readFromFile()
 	return &c
@@ -38,6 +38,16 @@ func parseCommandLine() {
 	port := flag.Uint("port", uint(conf.Port), "set AF_INET listen `port`")
 	flag.StringVar(&conf.Sockfile, "sockfile", conf.Sockfile,
 		"set AF_UNIX socket `file` in working directory")
+	flag.BoolVar(&conf.TLS, "tls", conf.TLS, "enable TLS on AF_INET "+
+		"listener")
+	flag.StringVar(&conf.TLSCert, "tls-cert", conf.TLSCert,
+		"set TLS certificate `file` in working directory")
+	flag.StringVar(&conf.TLSKey, "tls-key", conf.TLSKey,
+		"set TLS key `file` in working directory")
+	flag.StringVar(&conf.TLSClientCA, "tls-client-ca", conf.TLSClientCA,
+		"set CA certificate `file` in working directory that "+
+			"verifies client certificates; empty disables client "+
+			"certificate verification")
 	// note: the argument "dir" is also parsed in readConfigFile()
 	flag.StringVar(&conf.Dir, "dir", conf.Dir, "set working `directory`")
 	loglevel := flag.String("loglevel", conf.Loglevel,
@@ -50,6 +60,26 @@ func parseCommandLine() {
 		"toggle filtering of own messages")
 	flag.BoolVar(&conf.DisableEncryption, "disable-encryption",
 		conf.DisableEncryption, "disable TLS encryption")
+	flag.UintVar(&conf.CatchUpLimit, "catch-up-limit", conf.CatchUpLimit,
+		"set maximum `number` of old messages per chat retrieved on "+
+			"connect, 0 disables the limit")
+	flag.StringVar(&conf.DisplayName, "display-name", conf.DisplayName,
+		"set display name `policy` of message senders: username, "+
+			"nickname_full_name, full_name")
+	flag.StringVar(&conf.Proxy, "proxy", conf.Proxy, "set proxy `url` "+
+		"of mattermost connections, e.g., socks5://localhost:1080; "+
+		"empty reads the proxy from the environment, \"direct\" "+
+		"disables the proxy")
+	flag.UintVar(&conf.CommandTimeout, "command-timeout",
+		conf.CommandTimeout, "set client command timeout in `seconds`, "+
+			"0 disables the timeout")
+	flag.StringVar(&conf.HTTPAddress, "http-address", conf.HTTPAddress,
+		"set http REST API listen `address`, e.g., localhost:32080; "+
+			"empty disables the http server")
+	flag.StringVar(&conf.MetricsAddress, "metrics-address",
+		conf.MetricsAddress, "set metrics and health endpoint listen "+
+			"`address`, e.g., localhost:32090; empty disables the "+
+			"endpoints")
 
 	// parse command line arguments
 	flag.Parse()
@@ -101,6 +131,10 @@ func Run() {
 	// start accounts and client connections
 	startAccounts(context.Background())
 
+	// start http and metrics servers
+	runHTTPServer()
+	runMetricsServer()
+
 	// start server
 	runServer()
 
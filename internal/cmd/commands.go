@@ -0,0 +1,713 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// helpHeader is the first line of the help message
+	helpHeader = "info: List of commands and their description:\r\n"
+
+	// helpNotes is appended to the list of commands in the help message
+	helpNotes = `Commands can be prefixed with a tag "#<tag>", e.g., "#1 account list". All
+replies to a tagged command are prefixed with the same tag.
+Arguments can contain spaces if they are enclosed in double quotes or if the
+spaces are escaped with a backslash, e.g., "my chat" or my\ chat. Messages
+and other arguments at the end of send, topic, header and purpose commands
+are passed on unchanged.
+Chats <chat> and users <user> in send commands can be specified by channel
+id, by "<team>/<channel>" name, by "@<username>" for direct messages, or by
+the name, display name or alias of a joined channel.`
+
+	// helpIndent is the indentation of command descriptions in the help
+	helpIndent = "    "
+
+	// helpWidth is the maximum line width of the help message
+	helpWidth = 80
+)
+
+var (
+	// commands contains all client commands, see init()
+	commands []*command
+
+	// maxCommandWords is the maximum number of words of all commands
+	maxCommandWords int
+)
+
+// commandHandler is the function that handles a client command with the
+// account a (only set in account commands) and the command arguments args
+type commandHandler func(s *server, ctx context.Context, a *account,
+	args []string)
+
+// commandArg is an argument of a client command
+type commandArg struct {
+	name     string
+	optional bool
+}
+
+// command is a client command
+type command struct {
+	// syntax is the syntax of the command, e.g.,
+	// "account <id> chat send <chat> <msg>"; "<id>" is the account id,
+	// "<arg>" is a required and "[arg]" an optional argument
+	syntax string
+
+	// help is the description of the command
+	help string
+
+	// handler handles the command
+	handler commandHandler
+
+	// rest indicates that the last argument contains all remaining
+	// arguments of the command line separated by spaces
+	rest bool
+
+	// raw indicates that the last argument contains the unparsed rest of
+	// the command line, e.g., a message
+	raw bool
+
+	// sync indicates that the command is handled before the following
+	// commands are read from the client
+	sync bool
+
+	// ordered indicates that the command is handled after the previous
+	// ordered command is done
+	ordered bool
+
+	// noClient indicates that the account command works without a
+	// mattermost client of the account
+	noClient bool
+
+	// words are the words in syntax that identify the command
+	words []string
+
+	// args are the arguments in syntax
+	args []commandArg
+}
+
+// parseSyntax parses the words and arguments of the command from its syntax
+func (c *command) parseSyntax() {
+	c.words = nil
+	c.args = nil
+	for _, token := range splitSyntax(c.syntax) {
+		switch {
+		case token == "<id>":
+			c.words = append(c.words, token)
+		case strings.HasPrefix(token, "<"):
+			c.args = append(c.args, commandArg{name: token})
+		case strings.HasPrefix(token, "["):
+			c.args = append(c.args, commandArg{
+				name:     token,
+				optional: true,
+			})
+		default:
+			c.words = append(c.words, token)
+		}
+	}
+}
+
+// isAccountCommand checks if the command is an account command that contains
+// an account id
+func (c *command) isAccountCommand() bool {
+	return len(c.words) > 1 && c.words[1] == "<id>"
+}
+
+// match checks if the command line parts start with the words of the command
+func (c *command) match(parts []string) bool {
+	if len(parts) < len(c.words) {
+		return false
+	}
+	for i, word := range c.words {
+		if word == "<id>" {
+			if !isAccountID(parts[i]) {
+				return false
+			}
+			continue
+		}
+		if parts[i] != word {
+			return false
+		}
+	}
+	return true
+}
+
+// parseArgs parses the arguments of the command from args; optional
+// arguments that are not present are set to empty strings
+func (c *command) parseArgs(args []string) ([]string, error) {
+	if c.raw && len(args) > len(c.args) {
+		// raw commands must not get more args than they have
+		return nil, c.usageError()
+	}
+	required := 0
+	for _, arg := range c.args {
+		if !arg.optional {
+			required++
+		}
+	}
+	if len(args) < required {
+		return nil, c.usageError()
+	}
+	if len(args) > len(c.args) {
+		if !c.rest || len(c.args) == 0 {
+			return nil, c.usageError()
+		}
+		last := len(c.args) - 1
+		args = append(args[:last:last],
+			strings.Join(args[last:], " "))
+	}
+	for len(args) < len(c.args) {
+		args = append(args, "")
+	}
+	return args, nil
+}
+
+// usageError returns the usage error of the command
+func (c *command) usageError() error {
+	return fmt.Errorf("usage: %s", c.syntax)
+}
+
+// getHelp returns the help message of the command
+func (c *command) getHelp() string {
+	return c.syntax + "\r\n" + wrapText(c.help, helpIndent, helpWidth)
+}
+
+// nextToken returns the next token in line and the rest of line after the
+// token and a single separating space; spaces before the token are skipped.
+// A token can contain double quoted parts and characters escaped with a
+// backslash
+func nextToken(line string) (token, rest string, err error) {
+	line = strings.TrimLeft(line, " ")
+	quoted := false
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+			continue
+		case r == '"':
+			quoted = !quoted
+			continue
+		case r == ' ' && !quoted:
+			return token, line[i+1:], nil
+		}
+		token += string(r)
+	}
+	if quoted || escaped {
+		return "", "", errors.New("unterminated quote or escape " +
+			"in command")
+	}
+	return token, "", nil
+}
+
+// splitCommandLine splits line into at most n tokens, see nextToken, and
+// returns them with the unparsed rest of line; if n is negative, all tokens
+// are returned. On error, the tokens before the error are returned
+func splitCommandLine(line string, n int) (
+	tokens []string, rest string, err error) {
+	rest = line
+	for n != 0 && strings.TrimLeft(rest, " ") != "" {
+		var token string
+		token, rest, err = nextToken(rest)
+		if err != nil {
+			return tokens, "", err
+		}
+		tokens = append(tokens, token)
+		n--
+	}
+	return tokens, rest, nil
+}
+
+// isAccountID checks if word looks like an account id, i.e., only contains
+// digits
+func isAccountID(word string) bool {
+	return word != "" && strings.Trim(word, "0123456789") == ""
+}
+
+// splitSyntax splits syntax into words and arguments; arguments in brackets
+// can contain spaces
+func splitSyntax(syntax string) []string {
+	var tokens []string
+	token := ""
+	depth := 0
+	for _, r := range syntax {
+		switch r {
+		case '<', '[':
+			depth++
+		case '>', ']':
+			depth--
+		case ' ':
+			if depth == 0 {
+				if token != "" {
+					tokens = append(tokens, token)
+				}
+				token = ""
+				continue
+			}
+		}
+		token += string(r)
+	}
+	if token != "" {
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// wrapText wraps text into lines with indent that are not longer than width
+func wrapText(text, indent string, width int) string {
+	wrapped := ""
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(indent)+len(line)+1+len(word) > width {
+			wrapped += indent + line + "\r\n"
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		wrapped += indent + line + "\r\n"
+	}
+	return wrapped
+}
+
+// commandCall is a command received from the client with its account and
+// arguments
+type commandCall struct {
+	cmd     *command
+	account *account
+	args    []string
+}
+
+// findCommand returns the command that matches the command line parts; if
+// there are multiple matching commands, it returns the one with most words
+func findCommand(parts []string) *command {
+	var found *command
+	for _, c := range commands {
+		if !c.match(parts) {
+			continue
+		}
+		if found == nil || len(c.words) > len(found.words) {
+			found = c
+		}
+	}
+	return found
+}
+
+// parseCommand parses the command line and returns the command call
+func parseCommand(line string) (*commandCall, error) {
+	// find command, ignore errors in the arguments for now
+	parts, _, _ := splitCommandLine(line, maxCommandWords)
+	c := findCommand(parts)
+	if c == nil {
+		return nil, fmt.Errorf("unknown command %s, enter \"help\" "+
+			"for a list of commands", line)
+	}
+
+	// split command line into the words and arguments of the command;
+	// if the command is raw, its last argument is the rest of the line
+	n := -1
+	if c.raw {
+		n = len(c.words) + len(c.args) - 1
+	}
+	parts, rest, err := splitCommandLine(line, n)
+	if err != nil {
+		return nil, err
+	}
+	if c.raw && rest != "" {
+		parts = append(parts, rest)
+	}
+	return newCommandCall(c, parts)
+}
+
+// parseCommandParts parses the command from parts that contain the words and
+// arguments of the command, e.g., from a json command, and returns the
+// command call
+func parseCommandParts(parts []string) (*commandCall, error) {
+	c := findCommand(parts)
+	if c == nil {
+		return nil, fmt.Errorf("unknown command %s, enter \"help\" "+
+			"for a list of commands", strings.Join(parts, " "))
+	}
+	return newCommandCall(c, parts)
+}
+
+// newCommandCall creates a call of command c with the words and arguments in
+// parts
+func newCommandCall(c *command, parts []string) (*commandCall, error) {
+	// parse arguments
+	args, err := c.parseArgs(parts[len(c.words):])
+	if err != nil {
+		return nil, err
+	}
+	call := &commandCall{
+		cmd:  c,
+		args: args,
+	}
+	if !c.isAccountCommand() {
+		return call, nil
+	}
+
+	// get account
+	id, err := strconv.ParseUint(parts[1], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid account id %s", parts[1])
+	}
+	a := getAccount(int(id))
+	if a == nil {
+		return nil, fmt.Errorf("unknown account %d", id)
+	}
+	if a.client == nil && !c.noClient {
+		if a.Disabled {
+			return nil, fmt.Errorf("account %d is disabled", id)
+		}
+		return nil, fmt.Errorf("unsupported protocol %s", a.Protocol)
+	}
+	call.account = a
+	return call, nil
+}
+
+// getHelpMessage returns the help message for all commands whose words
+// start with words; account ids in words are ignored
+func getHelpMessage(words []string) (*message, error) {
+	var filter []string
+	for _, w := range words {
+		if w == "<id>" || isAccountID(w) {
+			continue
+		}
+		filter = append(filter, w)
+	}
+
+	var cmds []*command
+	for _, c := range commands {
+		var cmdWords []string
+		for _, w := range c.words {
+			if w != "<id>" {
+				cmdWords = append(cmdWords, w)
+			}
+		}
+		if len(cmdWords) < len(filter) {
+			continue
+		}
+		if strings.Join(cmdWords[:len(filter)], " ") !=
+			strings.Join(filter, " ") {
+			continue
+		}
+		cmds = append(cmds, c)
+	}
+	if len(cmds) == 0 {
+		return nil, fmt.Errorf("unknown command %s, enter \"help\" "+
+			"for a list of commands", strings.Join(words, " "))
+	}
+	return newHelpMessage(cmds, len(filter) == 0), nil
+}
+
+func init() {
+	commands = []*command{
+		{
+			syntax:  "account list",
+			help:    "list all accounts and their account ids.",
+			handler: (*server).handleAccountList,
+		},
+		{
+			syntax: "account add <protocol> <user> <password> " +
+				"[name]",
+			help: "add a new account for chat protocol <protocol> " +
+				"with user name <user> and the password " +
+				"<password>. The supported chat protocol(s) " +
+				"are backend specific. The user name is chat " +
+				"protocol specific, e.g., <login>@<server> " +
+				"or <login>@https://<server>/<path>. An " +
+				"account id is assigned to the account that " +
+				"can be shown with \"account list\". The " +
+				"optional [name] without spaces is shown in " +
+				"the account list, by default it is the " +
+				"server and teams of the account.",
+			handler: (*server).handleAccountAdd,
+			sync:    true,
+		},
+		{
+			syntax: "account <id> delete",
+			help: "delete the account with the account id " +
+				"<id>.",
+			handler:  (*server).handleAccountDelete,
+			sync:     true,
+			noClient: true,
+		},
+		{
+			syntax: "account <id> edit <field> <value>",
+			help: "set the field <field> of the account with the " +
+				"account id <id> to <value>. Fields: name, " +
+				"user, password. The account reconnects with " +
+				"a new user or password. The name \"default\" " +
+				"resets the name to the server and teams.",
+			handler:  (*server).handleAccountEdit,
+			sync:     true,
+			noClient: true,
+		},
+		{
+			syntax: "account <id> enable",
+			help: "enable and connect the account with the " +
+				"account id <id>.",
+			handler:  (*server).handleAccountEnable,
+			sync:     true,
+			noClient: true,
+		},
+		{
+			syntax: "account <id> disable",
+			help: "disconnect and disable the account with the " +
+				"account id <id>. Disabled accounts are kept " +
+				"but not connected.",
+			handler:  (*server).handleAccountDisable,
+			sync:     true,
+			noClient: true,
+		},
+		{
+			syntax: "account <id> reconnect",
+			help: "reconnect the account with the account id " +
+				"<id>.",
+			handler: (*server).handleAccountReconnect,
+			sync:    true,
+		},
+		{
+			syntax: "account <id> get [key]",
+			help: "show the settings or, optionally, the setting " +
+				"[key] of the account with the account id " +
+				"<id>. Settings that are not set for the " +
+				"account show the global default.",
+			handler:  (*server).handleAccountGet,
+			noClient: true,
+		},
+		{
+			syntax: "account <id> set <key> <value>",
+			help: "set the setting <key> of the account with the " +
+				"account id <id> to <value>; \"default\" resets " +
+				"the setting to the global default. The " +
+				"account reconnects with the new setting. " +
+				"Settings: filter_own, disable_history, " +
+				"disable_encryption, catch_up_limit, " +
+				"display_name, proxy, keywords, tls_ca, " +
+				"tls_cert, tls_key, tls_min_version, " +
+				"tls_pins.",
+			handler:  (*server).handleAccountSet,
+			sync:     true,
+			noClient: true,
+		},
+		{
+			syntax: "account <id> buddies [online]",
+			help: "list all buddies on the account with the " +
+				"account id <id>. Optionally, show only " +
+				"online buddies with the extra parameter " +
+				"\"online\": group chats and direct chats " +
+				"with users that are online.",
+			handler: (*server).handleAccountBuddies,
+		},
+		{
+			syntax: "account <id> collect",
+			help: "collect all messages received on the account " +
+				"with the account id <id>.",
+			handler: (*server).handleAccountCollect,
+		},
+		{
+			syntax: "account <id> send <user> <msg>",
+			help: "send a message to the user <user> on the " +
+				"account with the account id <id>.",
+			handler: (*server).handleAccountSend,
+			raw:     true,
+			ordered: true,
+		},
+		{
+			syntax: "account <id> status get",
+			help: "get the status of the account with the " +
+				"account id <id>.",
+			handler: (*server).handleAccountStatusGet,
+		},
+		{
+			syntax: "account <id> status set <status>",
+			help: "set the status of the account with the " +
+				"account id <id> to <status>.",
+			handler: (*server).handleAccountStatusSet,
+		},
+		{
+			syntax: "account <id> chat list",
+			help: "list all group chats on the account with the " +
+				"account id <id> and their numbers of unread " +
+				"messages and mentions.",
+			handler: (*server).handleAccountChatList,
+		},
+		{
+			syntax: "account <id> chat browse [team]",
+			help: "list the public group chats in team [team] " +
+				"that can be joined on the account with the " +
+				"account id <id>. If [team] is omitted, the " +
+				"first team is used.",
+			handler: (*server).handleAccountChatBrowse,
+		},
+		{
+			syntax: "account <id> chat create <team>/<chat> " +
+				"[public|private] [display name]",
+			help: "create the group chat <chat> in team <team> " +
+				"on the account with the account id <id>. " +
+				"Optionally, set the type of the group chat " +
+				"to public or private (default) and its " +
+				"display name to [display name].",
+			handler: (*server).handleAccountChatCreate,
+			raw:     true,
+		},
+		{
+			syntax: "account <id> chat join <chat>",
+			help: "join the existing group chat <chat> on the " +
+				"account with the account id <id>.",
+			handler: (*server).handleAccountChatJoin,
+		},
+		{
+			syntax: "account <id> chat part <chat>",
+			help: "leave the group chat <chat> on the account " +
+				"with the account id <id>.",
+			handler: (*server).handleAccountChatPart,
+		},
+		{
+			syntax: "account <id> chat topic <chat> [topic]",
+			help: "show or set the topic of the group chat " +
+				"<chat> on the account with the account id " +
+				"<id>. The topic of a group chat is its " +
+				"header.",
+			handler: (*server).handleAccountChatHeader,
+			raw:     true,
+		},
+		{
+			syntax: "account <id> chat header <chat> [header]",
+			help: "show or set the header of the group chat " +
+				"<chat> on the account with the account id " +
+				"<id>.",
+			handler: (*server).handleAccountChatHeader,
+			raw:     true,
+		},
+		{
+			syntax: "account <id> chat purpose <chat> [purpose]",
+			help: "show or set the purpose of the group chat " +
+				"<chat> on the account with the account id " +
+				"<id>.",
+			handler: (*server).handleAccountChatPurpose,
+			raw:     true,
+		},
+		{
+			syntax: "account <id> chat rename <chat> " +
+				"<display name>",
+			help: "set the display name of the group chat " +
+				"<chat> on the account with the account id " +
+				"<id> to <display name>.",
+			handler: (*server).handleAccountChatRename,
+			rest:    true,
+		},
+		{
+			syntax: "account <id> chat archive <chat>",
+			help: "archive the group chat <chat> on the account " +
+				"with the account id <id>.",
+			handler: (*server).handleAccountChatArchive,
+		},
+		{
+			syntax: "account <id> chat send <chat> <msg>",
+			help: "send the message <msg> to the group chat " +
+				"<chat> on the account with the account id " +
+				"<id>.",
+			handler: (*server).handleAccountChatSend,
+			raw:     true,
+			ordered: true,
+		},
+		{
+			syntax: "account <id> chat read <chat>",
+			help: "mark the group chat <chat> on the account " +
+				"with the account id <id> as read.",
+			handler: (*server).handleAccountChatRead,
+		},
+		{
+			syntax: "account <id> chat users <chat> [filter]",
+			help: "list the users in the group chat <chat> on " +
+				"the account with the account id <id>. " +
+				"Optionally, show only users whose name " +
+				"starts with [filter].",
+			handler: (*server).handleAccountChatUsers,
+		},
+		{
+			syntax: "account <id> chat invite <chat> <user>",
+			help: "invite the user <user> to the group chat " +
+				"<chat> on the account with the account id " +
+				"<id>.",
+			handler: (*server).handleAccountChatInvite,
+		},
+		{
+			syntax: "account <id> chat kick <chat> <user>",
+			help: "remove the user <user> from the group chat " +
+				"<chat> on the account with the account id " +
+				"<id>.",
+			handler: (*server).handleAccountChatKick,
+		},
+		{
+			syntax: "account <id> chat op <chat> <user>",
+			help: "make the user <user> an admin of the group " +
+				"chat <chat> on the account with the account " +
+				"id <id>.",
+			handler: (*server).handleAccountChatOp,
+		},
+		{
+			syntax: "account <id> chat deop <chat> <user>",
+			help: "remove the admin role of the user <user> in " +
+				"the group chat <chat> on the account with " +
+				"the account id <id>.",
+			handler: (*server).handleAccountChatDeop,
+		},
+		{
+			syntax:  "version",
+			help:    "get version of the backend",
+			handler: (*server).handleVersion,
+		},
+		{
+			syntax: "client protocol <nuqql|json>",
+			help: "set the protocol of this client connection " +
+				"to the nuqql line protocol or to the json " +
+				"lines protocol.",
+			handler: (*server).handleClientProtocol,
+			sync:    true,
+		},
+		{
+			syntax: "auth <secret>",
+			help: "authenticate this client connection with the " +
+				"shared secret <secret>; if authentication " +
+				"is enabled, all other commands are rejected " +
+				"until the client is authenticated.",
+			handler: (*server).handleAuth,
+			sync:    true,
+		},
+		{
+			syntax:  "bye",
+			help:    "disconnect from backend",
+			handler: (*server).handleBye,
+			sync:    true,
+		},
+		{
+			syntax:  "quit",
+			help:    "quit backend",
+			handler: (*server).handleQuit,
+			sync:    true,
+		},
+		{
+			syntax: "help [command]",
+			help: "show this help or, optionally, the help of " +
+				"the command [command].",
+			handler: (*server).handleHelp,
+			rest:    true,
+		},
+	}
+	for _, c := range commands {
+		c.parseSyntax()
+		maxCommandWords = max(maxCommandWords, len(c.words))
+	}
+}
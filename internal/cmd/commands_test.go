@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitSyntax(t *testing.T) {
+	syntax := "account <id> chat create <team>/<chat> [public|private] " +
+		"[display name]"
+	want := []string{"account", "<id>", "chat", "create",
+		"<team>/<chat>", "[public|private]", "[display name]"}
+	got := splitSyntax(syntax)
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+}
+
+func TestCommandParseSyntax(t *testing.T) {
+	c := &command{syntax: "account <id> chat users <chat> [filter]"}
+	c.parseSyntax()
+
+	// check words
+	wantWords := []string{"account", "<id>", "chat", "users"}
+	if !slices.Equal(c.words, wantWords) {
+		t.Errorf("got %q, wanted %q", c.words, wantWords)
+	}
+
+	// check arguments
+	wantArgs := []commandArg{
+		{name: "<chat>"},
+		{name: "[filter]", optional: true},
+	}
+	if !slices.Equal(c.args, wantArgs) {
+		t.Errorf("got %v, wanted %v", c.args, wantArgs)
+	}
+}
+
+func TestCommandParseArgs(t *testing.T) {
+	c := &command{
+		syntax: "account <id> chat create <team>/<chat> " +
+			"[public|private] [display name]",
+		rest: true,
+	}
+	c.parseSyntax()
+
+	// test missing arguments
+	if _, err := c.parseArgs(nil); err == nil {
+		t.Errorf("got %v, wanted error", err)
+	}
+
+	// test rest of command line
+	want := []string{"chat", "public", "my new chat"}
+	got, err := c.parseArgs([]string{"chat", "public", "my", "new", "chat"})
+	if err != nil || !slices.Equal(got, want) {
+		t.Errorf("got %q, %v, wanted %q", got, err, want)
+	}
+
+	// test missing optional argument
+	c = &command{syntax: "account <id> chat users <chat> [filter]"}
+	c.parseSyntax()
+	want = []string{"chat", ""}
+	got, err = c.parseArgs([]string{"chat"})
+	if err != nil || !slices.Equal(got, want) {
+		t.Errorf("got %q, %v, wanted %q", got, err, want)
+	}
+
+	// test too many arguments
+	if _, err := c.parseArgs([]string{"chat", "a", "b"}); err == nil {
+		t.Errorf("got %v, wanted error", err)
+	}
+}
+
+func TestFindCommand(t *testing.T) {
+	for cmd, want := range map[string]string{
+		"account list":               "account list",
+		"account add a b c":          "account add <protocol> <user> <password> [name]",
+		"account 1 chat list":        "account <id> chat list",
+		"account 1 chat send c msg":  "account <id> chat send <chat> <msg>",
+		"account 1 status set away":  "account <id> status set <status>",
+		"help account 1 chat":        "help [command]",
+		"account add 1 chat list":    "account add <protocol> <user> <password> [name]",
+		"account 1 send user msg":    "account <id> send <user> <msg>",
+		"account foo chat list":      "",
+		"account 1 unknown":          "",
+		"unknown command":            "",
+		"account 1 chat unknown 123": "",
+	} {
+		got := ""
+		if c := findCommand(strings.Split(cmd, " ")); c != nil {
+			got = c.syntax
+		}
+		if got != want {
+			t.Errorf("%s: got %q, wanted %q", cmd, got, want)
+		}
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	accounts = make(map[int]*account)
+	defer func() {
+		// cleanup
+		accounts = make(map[int]*account)
+	}()
+	accounts[1] = &account{ID: 1, Protocol: "test"}
+
+	// test unknown account
+	_, err := parseCommand("account 2 delete")
+	if err == nil {
+		t.Errorf("got %v, wanted error", err)
+	}
+
+	// test account without client
+	_, err = parseCommand("account 1 chat list")
+	if err == nil {
+		t.Errorf("got %v, wanted error", err)
+	}
+
+	// test account command that does not need a client
+	call, err := parseCommand("account 1 delete")
+	if err != nil || call.account.ID != 1 {
+		t.Errorf("got %v, %v, wanted %v", call, err, accounts[1])
+	}
+}
+
+func TestParseCommandArgs(t *testing.T) {
+	for _, test := range []struct {
+		line string
+		want []string
+	}{
+		{"help", []string{""}},
+		{"help  account   list", []string{"account list"}},
+		{`account add mattermost "my user" pass\ word`,
+			[]string{"mattermost", "my user", "pass word", ""}},
+		{`account add mattermost "" "a \"b\""`,
+			[]string{"mattermost", "", `a "b"`, ""}},
+		{`account add "matter"most user pass`,
+			[]string{"mattermost", "user", "pass", ""}},
+		{`account add mattermost user pass work`,
+			[]string{"mattermost", "user", "pass", "work"}},
+	} {
+		call, err := parseCommand(test.line)
+		if err != nil || !slices.Equal(call.args, test.want) {
+			t.Errorf("%s: got %v, %v, wanted %q", test.line, call,
+				err, test.want)
+		}
+	}
+
+	// test invalid quotes and escapes
+	for _, line := range []string{
+		`account add mattermost "user pass`,
+		`account add mattermost user pass\`,
+	} {
+		if _, err := parseCommand(line); err == nil {
+			t.Errorf("%s: got %v, wanted error", line, err)
+		}
+	}
+}
+
+func TestParseCommandRaw(t *testing.T) {
+	accounts = make(map[int]*account)
+	defer func() {
+		// cleanup
+		accounts = make(map[int]*account)
+	}()
+	accounts[1] = &account{ID: 1, Protocol: "test", client: &mattermost{}}
+
+	// messages are passed on unchanged
+	for _, test := range []struct {
+		line string
+		want []string
+	}{
+		{`account 1 chat send "my chat" hello  "world`,
+			[]string{"my chat", `hello  "world`}},
+		{`account 1 send user  \hi`, []string{"user", ` \hi`}},
+		{`account 1 chat topic chat`, []string{"chat", ""}},
+		{`account 1 chat topic chat new "topic`,
+			[]string{"chat", `new "topic`}},
+		{`account 1 chat purpose chat new  "purpose"`,
+			[]string{"chat", `new  "purpose"`}},
+	} {
+		call, err := parseCommand(test.line)
+		if err != nil || !slices.Equal(call.args, test.want) {
+			t.Errorf("%s: got %v, %v, wanted %q", test.line, call,
+				err, test.want)
+		}
+	}
+
+	// test missing message
+	if _, err := parseCommand("account 1 chat send chat "); err == nil {
+		t.Errorf("got %v, wanted error", err)
+	}
+}
+
+func TestParseCommandParts(t *testing.T) {
+	// test arguments with spaces and quotes
+	want := []string{"mattermost", `my "user"`, "pass word", ""}
+	call, err := parseCommandParts([]string{"account", "add",
+		"mattermost", `my "user"`, "pass word"})
+	if err != nil || !slices.Equal(call.args, want) {
+		t.Errorf("got %v, %v, wanted %q", call, err, want)
+	}
+
+	// test unknown command
+	if _, err := parseCommandParts([]string{"unknown"}); err == nil {
+		t.Errorf("got %v, wanted error", err)
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	text := "this is a test text that should be wrapped"
+	want := "  this is a\r\n  test text\r\n  that\r\n  should be\r\n" +
+		"  wrapped\r\n"
+	got := wrapText(text, "  ", 12)
+	if got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+}
+
+func TestGetHelpMessage(t *testing.T) {
+	// test help of all commands
+	msg, err := getHelpMessage(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := msg.line
+	for _, c := range commands {
+		if !strings.Contains(got, c.syntax+"\r\n") {
+			t.Errorf("help does not contain %s", c.syntax)
+		}
+	}
+
+	// test help of a single command, account ids are ignored
+	want := helpHeader + commands[0].getHelp()
+	msg, err = getHelpMessage([]string{"account", "list"})
+	if err != nil || msg.line != want {
+		t.Errorf("got %v, %v, wanted %q", msg, err, want)
+	}
+	msg, err = getHelpMessage([]string{"account", "1", "chat", "send"})
+	if err != nil || !strings.Contains(msg.line, "chat send <chat> <msg>") {
+		t.Errorf("got %v, %v", msg, err)
+	}
+
+	// test unknown command
+	if _, err := getHelpMessage([]string{"unknown"}); err == nil {
+		t.Errorf("got %v, wanted error", err)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	for _, c := range commands {
+		if c.handler == nil {
+			t.Errorf("%s: missing handler", c.syntax)
+		}
+		if c.help == "" {
+			t.Errorf("%s: missing help", c.syntax)
+		}
+		if (c.rest || c.raw) && len(c.args) == 0 {
+			t.Errorf("%s: rest without arguments", c.syntax)
+		}
+		if c.rest && c.raw {
+			t.Errorf("%s: rest and raw", c.syntax)
+		}
+	}
+}
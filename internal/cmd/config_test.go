@@ -6,7 +6,10 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"testing"
+	"time"
 )
 
 func TestGetListenNetwork(t *testing.T) {
@@ -81,7 +84,7 @@ func TestReadFromFile(t *testing.T) {
 	got.Dir = dir
 	got.ReadFromFile()
 
-	if *got != *want {
+	if !reflect.DeepEqual(got, want) {
 		t.Errorf("got %v, wanted %v", got, want)
 	}
 
@@ -93,7 +96,7 @@ func TestReadFromFile(t *testing.T) {
 	got.Dir = dir
 	got.ReadFromFile()
 
-	if *got != *want {
+	if !reflect.DeepEqual(got, want) {
 		t.Errorf("got %v, wanted %v", got, want)
 	}
 
@@ -110,7 +113,7 @@ func TestReadFromFile(t *testing.T) {
 	got.Dir = dir
 	got.ReadFromFile()
 
-	if *got != *want {
+	if !reflect.DeepEqual(got, want) {
 		t.Errorf("got %v, wanted %v", got, want)
 	}
 
@@ -121,11 +124,32 @@ func TestReadFromFile(t *testing.T) {
 	want.Address = "192.168.1.1"
 	want.Port = 12345
 	want.Sockfile = "test.sock"
+	want.AllowedUIDs = []uint32{1000, 1001}
+	want.TLS = true
+	want.TLSCert = "test-cert.pem"
+	want.TLSKey = "test-key.pem"
+	want.TLSClientCA = "ca.pem"
+	want.AuthSecret = "secret"
+	want.Listeners = []Listener{
+		{Network: "tcp6", Address: "[::1]:32000", TLS: true},
+		{Network: "unix", Address: "test.sock", Protocol: "json",
+			DisableAuth: true},
+	}
 	want.Loglevel = "debug"
 	want.DisableHistory = true
 	want.PushAccounts = true
 	want.FilterOwn = true
 	want.DisableEncryption = true
+	want.Proxy = "socks5://localhost:1080"
+	want.CatchUpLimit = 100
+	want.DisplayName = "username"
+	want.CommandTimeout = 30
+	want.Keywords = []string{"foo", "bar"}
+	want.Hooks = []Hook{{Event: "message", Command: []string{"true"}}}
+	want.HookTimeout = 10
+	want.MaxHooks = 2
+	want.HTTPAddress = "localhost:32080"
+	want.MetricsAddress = "localhost:32090"
 
 	b, err := json.Marshal(want)
 	if err != nil {
@@ -137,7 +161,7 @@ func TestReadFromFile(t *testing.T) {
 	got.Dir = dir
 	got.ReadFromFile()
 
-	if *got != *want {
+	if !reflect.DeepEqual(got, want) {
 		t.Errorf("got %v, wanted %v", got, want)
 	}
 }
@@ -153,11 +177,16 @@ func TestNewConfig(t *testing.T) {
 	address := "localhost"
 	port := uint16(32000)
 	sockfile := name + ".sock"
+	tlsCert := "cert.pem"
+	tlsKey := "key.pem"
 	loglevel := "warn"
 	disableHistory := false
 	pushAccounts := false
 	filterOwn := false
 	disableEncryption := false
+	commandTimeout := uint(60)
+	hookTimeout := uint(30)
+	maxHooks := uint(4)
 
 	c := NewConfig(name)
 	if c.Name != name {
@@ -178,6 +207,12 @@ func TestNewConfig(t *testing.T) {
 	if c.Sockfile != sockfile {
 		t.Errorf("got %s, wanted %s", c.Sockfile, sockfile)
 	}
+	if c.TLSCert != tlsCert {
+		t.Errorf("got %s, wanted %s", c.TLSCert, tlsCert)
+	}
+	if c.TLSKey != tlsKey {
+		t.Errorf("got %s, wanted %s", c.TLSKey, tlsKey)
+	}
 	if c.Loglevel != loglevel {
 		t.Errorf("got %s, wanted %s", c.Loglevel, loglevel)
 	}
@@ -194,4 +229,152 @@ func TestNewConfig(t *testing.T) {
 		t.Errorf("got %t, wanted %t", c.DisableEncryption,
 			disableEncryption)
 	}
+	if c.CommandTimeout != commandTimeout {
+		t.Errorf("got %d, wanted %d", c.CommandTimeout, commandTimeout)
+	}
+	if c.HookTimeout != hookTimeout {
+		t.Errorf("got %d, wanted %d", c.HookTimeout, hookTimeout)
+	}
+	if c.MaxHooks != maxHooks {
+		t.Errorf("got %d, wanted %d", c.MaxHooks, maxHooks)
+	}
+}
+
+func TestGetListeners(t *testing.T) {
+	c := NewConfig("testConfig")
+
+	// test default listener
+	want := []Listener{{Network: "tcp", Address: "localhost:32000"}}
+	got := c.GetListeners()
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+
+	// test configured listeners
+	c.Listeners = []Listener{
+		{Network: "tcp", Address: "localhost:32001", TLS: true},
+		{Network: "unix", Address: "test.sock"},
+		{Network: "unix", Address: "/tmp/test.sock"},
+	}
+	want = []Listener{
+		{Network: "tcp", Address: "localhost:32001", TLS: true},
+		{Network: "unix", Address: filepath.Join(c.Dir, "test.sock")},
+		{Network: "unix", Address: "/tmp/test.sock"},
+	}
+	got = c.GetListeners()
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+	if c.Listeners[1].Address != "test.sock" {
+		t.Errorf("got %s, wanted test.sock", c.Listeners[1].Address)
+	}
+}
+
+func TestGetAuthSecret(t *testing.T) {
+	c := NewConfig("testConfig")
+	c.AuthSecret = "global"
+
+	for _, test := range []struct {
+		l    Listener
+		want string
+	}{
+		{Listener{}, "global"},
+		{Listener{AuthSecret: "own"}, "own"},
+		{Listener{AuthSecret: "own", DisableAuth: true}, ""},
+	} {
+		got := c.GetAuthSecret(&test.l)
+		if got != test.want {
+			t.Errorf("got %s, wanted %s", got, test.want)
+		}
+	}
+}
+
+func TestGetAllowedUIDs(t *testing.T) {
+	c := NewConfig("testConfig")
+
+	// test default
+	want := []uint32{uint32(os.Getuid())}
+	got := c.GetAllowedUIDs()
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+
+	// test configured user ids
+	want = []uint32{1000, 1001}
+	c.AllowedUIDs = want
+	got = c.GetAllowedUIDs()
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+func TestGetSocketMode(t *testing.T) {
+	c := NewConfig("testConfig")
+	uid := uint32(os.Getuid())
+
+	for _, test := range []struct {
+		uids []uint32
+		want os.FileMode
+	}{
+		{nil, 0600},
+		{[]uint32{uid}, 0600},
+		{[]uint32{uid, uid + 1}, 0660},
+	} {
+		c.AllowedUIDs = test.uids
+		got := c.GetSocketMode()
+		if got != test.want {
+			t.Errorf("got %o, wanted %o", got, test.want)
+		}
+	}
+}
+
+func TestGetSocketGroup(t *testing.T) {
+	c := NewConfig("testConfig")
+
+	// test default
+	if got, err := c.GetSocketGroup(); got != -1 || err != nil {
+		t.Errorf("got %d, %v, wanted -1, nil", got, err)
+	}
+
+	// test group id
+	c.SocketGroup = "1000"
+	if got, err := c.GetSocketGroup(); got != 1000 || err != nil {
+		t.Errorf("got %d, %v, wanted 1000, nil", got, err)
+	}
+
+	// test unknown group name
+	c.SocketGroup = "nuqql-unknown-group"
+	if _, err := c.GetSocketGroup(); err == nil {
+		t.Errorf("got nil, wanted error")
+	}
+}
+
+func TestGetCommandTimeout(t *testing.T) {
+	c := NewConfig("testConfig")
+	c.CommandTimeout = 5
+
+	want := 5 * time.Second
+	got := c.GetCommandTimeout()
+	if got != want {
+		t.Errorf("got %s, wanted %s", got, want)
+	}
+}
+
+func TestGetHookTimeout(t *testing.T) {
+	c := NewConfig("testConfig")
+	c.HookTimeout = 5
+
+	// test default timeout
+	want := 5 * time.Second
+	got := c.GetHookTimeout(&Hook{})
+	if got != want {
+		t.Errorf("got %s, wanted %s", got, want)
+	}
+
+	// test hook timeout
+	want = 2 * time.Second
+	got = c.GetHookTimeout(&Hook{Timeout: 2})
+	if got != want {
+		t.Errorf("got %s, wanted %s", got, want)
+	}
 }
@@ -0,0 +1,62 @@
+package cmd
+
+import "sync"
+
+const (
+	// eventBufferSize is the number of events buffered for a subscriber
+	eventBufferSize = 64
+)
+
+var (
+	// events distributes events to subscribers, e.g., http event streams
+	events = newEventHub()
+)
+
+// eventHub distributes events, e.g., received messages, to subscribers
+type eventHub struct {
+	mutex       sync.Mutex
+	subscribers map[chan *message]struct{}
+}
+
+// subscribe adds a new subscriber and returns its event channel
+func (h *eventHub) subscribe() chan *message {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	c := make(chan *message, eventBufferSize)
+	h.subscribers[c] = struct{}{}
+	return c
+}
+
+// unsubscribe removes the subscriber with the event channel c
+func (h *eventHub) unsubscribe(c chan *message) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.subscribers, c)
+}
+
+// publish sends the event msg to all subscribers; if the buffer of a
+// subscriber is full, the event is dropped for this subscriber
+func (h *eventHub) publish(msg *message) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for c := range h.subscribers {
+		select {
+		case c <- msg:
+		default:
+			logWarn("Event buffer full, dropping event", msg.Type)
+		}
+	}
+}
+
+// newEventHub creates a new event hub
+func newEventHub() *eventHub {
+	return &eventHub{
+		subscribers: make(map[chan *message]struct{}),
+	}
+}
+
+// sendEvent sends the event msg to the client and to all subscribers
+func sendEvent(msg *message) {
+	clientQueue.send(msg)
+	events.publish(msg)
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	// highlightDirect is the highlight reason of messages in direct chats
+	highlightDirect = "direct"
+
+	// highlightMention is the highlight reason of messages that mention
+	// the user
+	highlightMention = "mention"
+
+	// highlightChannel is the highlight reason of messages that mention
+	// all users in a channel with @channel, @here or @all
+	highlightChannel = "channel"
+
+	// highlightKeyword is the highlight reason of messages that contain
+	// a configured keyword
+	highlightKeyword = "keyword"
+)
+
+// isWordRune checks if r is part of a word or username
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-'
+}
+
+// containsWord checks if text contains word as a whole word; the check is
+// case-insensitive
+func containsWord(text, word string) bool {
+	if word == "" {
+		return false
+	}
+	text = strings.ToLower(text)
+	word = strings.ToLower(word)
+	for i := 0; i < len(text); {
+		j := strings.Index(text[i:], word)
+		if j == -1 {
+			return false
+		}
+		start := i + j
+		end := start + len(word)
+
+		// check runes before and after the match
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if (start == 0 || !isWordRune(before)) &&
+			(end == len(text) || !isWordRune(after)) {
+			return true
+		}
+		i = start + 1
+	}
+	return false
+}
+
+// isChannelMention checks if text mentions all users in a channel
+func isChannelMention(text string) bool {
+	for _, name := range []string{"@channel", "@here", "@all"} {
+		if containsWord(text, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// getHighlight returns the reason why the message text in a (direct) channel
+// should be highlighted for user or an empty string if it should not be
+// highlighted; mentions contains the ids of the mentioned users sent by the
+// server and is nil if they are not available
+func getHighlight(text string, direct bool, mentions []string,
+	user *model.User, keywords []string) string {
+
+	if direct {
+		return highlightDirect
+	}
+
+	// check mentions of the user and the whole channel
+	mention := containsWord(text, "@"+user.Username)
+	channel := isChannelMention(text)
+	if mentions != nil {
+		if !slices.Contains(mentions, user.Id) {
+			// server says user is not mentioned, e.g., because
+			// channel mentions are disabled
+			mention = false
+			channel = false
+		} else if !channel {
+			// server says user is mentioned, e.g., because of
+			// custom mention keys of the user
+			mention = true
+		}
+	}
+	switch {
+	case mention:
+		return highlightMention
+	case channel:
+		return highlightChannel
+	}
+
+	// check keywords
+	for _, k := range keywords {
+		if containsWord(text, k) {
+			return highlightKeyword
+		}
+	}
+	return ""
+}
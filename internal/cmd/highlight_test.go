@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+func TestContainsWord(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		word string
+		want bool
+	}{
+		{"hello world", "world", true},
+		{"Hello World!", "world", true},
+		{"hello worlds", "world", false},
+		{"underworld world", "world", true},
+		{"hi @user.", "@user", true},
+		{"hi @user-name", "@user", false},
+		{"mail foo@user.com", "@user", false},
+		{"hello", "", false},
+	} {
+		got := containsWord(test.text, test.word)
+		if got != test.want {
+			t.Errorf("%q, %q: got %t, wanted %t", test.text,
+				test.word, got, test.want)
+		}
+	}
+}
+
+func TestGetHighlight(t *testing.T) {
+	user := &model.User{Id: "id1", Username: "user"}
+	keywords := []string{"deploy"}
+	for _, test := range []struct {
+		text     string
+		direct   bool
+		mentions []string
+		want     string
+	}{
+		{"hello", true, nil, highlightDirect},
+		{"hello @user", false, nil, highlightMention},
+		{"hello @user", false, []string{"id1"}, highlightMention},
+		{"hello @here", false, nil, highlightChannel},
+		{"hello @channel", false, []string{"id1"}, highlightChannel},
+		{"hello @channel", false, []string{}, ""},
+		{"hello", false, []string{"id1"}, highlightMention},
+		{"we Deploy now", false, []string{}, highlightKeyword},
+		{"hello @other", false, nil, ""},
+	} {
+		got := getHighlight(test.text, test.direct, test.mentions, user,
+			keywords)
+		if got != test.want {
+			t.Errorf("%q: got %q, wanted %q", test.text, got,
+				test.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// hookEventMessage is the event of received messages
+	hookEventMessage = "message"
+
+	// hookEventMention is the event of highlighted messages, e.g.,
+	// mentions and direct messages
+	hookEventMention = "mention"
+
+	// hookEventOnline is the event of accounts going online
+	hookEventOnline = "online"
+
+	// hookEventOffline is the event of accounts going offline
+	hookEventOffline = "offline"
+
+	// hookWaitDelay is the time to wait for the output of a hook after
+	// it was killed, e.g., because of its timeout
+	hookWaitDelay = time.Second
+)
+
+var (
+	// hookSlots limits the number of concurrently running hooks
+	hookSlots     chan struct{}
+	hookSlotsOnce sync.Once
+)
+
+// Hook is an external command that is run on events
+type Hook struct {
+	// Event is the event that triggers the hook:
+	// message, mention, online, offline
+	Event string
+	// Command is the command and its arguments
+	Command []string
+	// Timeout is the timeout of the hook in seconds; 0 uses the
+	// default timeout of all hooks
+	Timeout uint
+	// CatchUp runs the hook also for old messages that are retrieved on
+	// connect
+	CatchUp bool
+}
+
+// matches checks if the hook h should be run for event
+func (h *Hook) matches(event *hookEvent) bool {
+	if h.Event != event.Event || len(h.Command) == 0 {
+		return false
+	}
+	return !event.CatchUp || h.CatchUp
+}
+
+// hookEvent contains the fields of an event that are passed to a hook as
+// environment variables and as json on stdin
+type hookEvent struct {
+	Event     string `json:"event"`
+	Account   int    `json:"account"`
+	Chat      string `json:"chat,omitempty"`
+	ChatType  string `json:"chat_type,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Sender    string `json:"sender,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	CatchUp   bool   `json:"catch_up,omitempty"`
+}
+
+// getEnv returns the environment variables of the event
+func (e *hookEvent) getEnv() []string {
+	return []string{
+		"NUQQL_EVENT=" + e.Event,
+		fmt.Sprintf("NUQQL_ACCOUNT=%d", e.Account),
+		"NUQQL_CHAT=" + e.Chat,
+		"NUQQL_CHAT_TYPE=" + e.ChatType,
+		fmt.Sprintf("NUQQL_TIMESTAMP=%d", e.Timestamp),
+		"NUQQL_SENDER=" + e.Sender,
+		"NUQQL_MESSAGE=" + e.Message,
+		"NUQQL_REASON=" + e.Reason,
+		"NUQQL_CATCH_UP=" + strconv.FormatBool(e.CatchUp),
+	}
+}
+
+// runHook runs the hook h for event and waits until it is done or its
+// timeout expires
+func runHook(h *Hook, event *hookEvent) error {
+	ctx := context.Background()
+	if timeout := conf.GetHookTimeout(h); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	stdin, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Env = append(os.Environ(), event.getEnv()...)
+	cmd.Stdin = bytes.NewReader(append(stdin, '\n'))
+	cmd.WaitDelay = hookWaitDelay
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		logDebug("Hook", h.Command[0], "output:", string(out))
+	}
+	return err
+}
+
+// getHookSlots returns the channel that limits the number of concurrently
+// running hooks
+func getHookSlots() chan struct{} {
+	hookSlotsOnce.Do(func() {
+		hookSlots = make(chan struct{}, max(conf.MaxHooks, 1))
+	})
+	return hookSlots
+}
+
+// runHooks runs all hooks configured for the event in the background; if too
+// many hooks are running, the hook is skipped
+func runHooks(event *hookEvent) {
+	for i := range conf.Hooks {
+		h := &conf.Hooks[i]
+		if !h.matches(event) {
+			continue
+		}
+
+		slots := getHookSlots()
+		select {
+		case slots <- struct{}{}:
+		default:
+			logWarn("Too many running hooks, skipping hook",
+				h.Command[0], "for event", event.Event)
+			continue
+		}
+		go func() {
+			defer func() { <-slots }()
+			logDebug("Running hook", h.Command[0], "for event",
+				event.Event)
+			if err := runHook(h, event); err != nil {
+				logError("Hook", h.Command[0], "failed:", err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHookEventGetEnv(t *testing.T) {
+	event := &hookEvent{
+		Event:   hookEventMessage,
+		Account: 1,
+		Chat:    "chat",
+		Sender:  "user",
+		Message: "hello",
+	}
+	env := event.getEnv()
+	for _, want := range []string{
+		"NUQQL_EVENT=message",
+		"NUQQL_ACCOUNT=1",
+		"NUQQL_CHAT=chat",
+		"NUQQL_SENDER=user",
+		"NUQQL_MESSAGE=hello",
+		"NUQQL_CATCH_UP=false",
+	} {
+		if !slices.Contains(env, want) {
+			t.Errorf("got %q, wanted %s", env, want)
+		}
+	}
+}
+
+func TestHookMatches(t *testing.T) {
+	message := &hookEvent{Event: hookEventMessage}
+	catchUp := &hookEvent{Event: hookEventMessage, CatchUp: true}
+	for _, test := range []struct {
+		h     *Hook
+		event *hookEvent
+		want  bool
+	}{
+		{&Hook{Event: "message", Command: []string{"true"}}, message,
+			true},
+		{&Hook{Event: "mention", Command: []string{"true"}}, message,
+			false},
+		{&Hook{Event: "message"}, message, false},
+		{&Hook{Event: "message", Command: []string{"true"}}, catchUp,
+			false},
+		{&Hook{Event: "message", Command: []string{"true"},
+			CatchUp: true}, catchUp, true},
+	} {
+		if got := test.h.matches(test.event); got != test.want {
+			t.Errorf("%v: got %t, wanted %t", test.h, got, test.want)
+		}
+	}
+}
+
+func TestRunHook(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "out")
+
+	// test hook with event on stdin and environment
+	event := &hookEvent{Event: hookEventOnline, Account: 2}
+	h := &Hook{Command: []string{"sh", "-c",
+		"cat > " + file + "; echo $NUQQL_EVENT >> " + file}}
+	if err := runHook(h, event); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := string(stdin) + "\nonline\n"
+	if got := string(b); got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+
+	// test hook timeout
+	h = &Hook{Command: []string{"sleep", "10"}, Timeout: 1}
+	start := time.Now()
+	if err := runHook(h, event); err == nil {
+		t.Errorf("got %v, wanted error", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("got %s, wanted timeout", d)
+	}
+}
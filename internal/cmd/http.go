@@ -0,0 +1,422 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+var (
+	// httpReadHeaderTimeout is the timeout for reading the request
+	// headers in the http servers
+	httpReadHeaderTimeout = 10 * time.Second
+)
+
+// httpError is an error with a http status code
+type httpError struct {
+	status int
+	err    error
+}
+
+// Error returns the error message
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+// getHTTPStatus returns the http status code for err
+func getHTTPStatus(err error) int {
+	var httpErr *httpError
+	var appErr *model.AppError
+	switch {
+	case errors.As(err, &httpErr):
+		return httpErr.status
+	case errors.Is(err, errOffline):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, errChannelNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errChannelAmbiguous):
+		return http.StatusConflict
+	case errors.As(err, &appErr) && appErr.StatusCode != 0:
+		return appErr.StatusCode
+	}
+	return http.StatusInternalServerError
+}
+
+// writeJSON writes v as json with the status code to w
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logError(err)
+	}
+}
+
+// writeError writes err as json to w
+func writeError(w http.ResponseWriter, err error) {
+	writeJSON(w, getHTTPStatus(err), &textData{getErrorMessage(err)})
+}
+
+// writeInfo writes an info message with format and args as json to w
+func writeInfo(w http.ResponseWriter, format string, args ...any) {
+	writeJSON(w, http.StatusOK, &textData{fmt.Sprintf(format, args...)})
+}
+
+// readJSON reads the json request body of r into v
+func readJSON(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return &httpError{http.StatusBadRequest, err}
+	}
+	return nil
+}
+
+// getHTTPAccount returns the mattermost account identified by the account
+// id in the path of r
+func getHTTPAccount(r *http.Request) (*account, error) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 16)
+	if err != nil {
+		return nil, &httpError{http.StatusBadRequest,
+			fmt.Errorf("invalid account id %s", r.PathValue("id"))}
+	}
+	a := getAccount(int(id))
+	if a == nil {
+		return nil, &httpError{http.StatusNotFound,
+			fmt.Errorf("unknown account %d", id)}
+	}
+	if a.client == nil && a.Disabled {
+		return nil, &httpError{http.StatusConflict,
+			fmt.Errorf("account %d is disabled", id)}
+	}
+	if a.client == nil {
+		return nil, &httpError{http.StatusBadRequest,
+			fmt.Errorf("unsupported protocol %s", a.Protocol)}
+	}
+	return a, nil
+}
+
+// accountHandler is a http handler for requests to the account a
+type accountHandler func(w http.ResponseWriter, r *http.Request, a *account)
+
+// handleAccount returns a http handler that calls h with the account in the
+// request path
+func handleAccount(h accountHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a, err := getHTTPAccount(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if timeout := conf.GetCommandTimeout(); timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		h(w, r, a)
+	}
+}
+
+// handleHTTPAccounts handles a request for the account list
+func handleHTTPAccounts(w http.ResponseWriter, _ *http.Request) {
+	accounts := []any{}
+	for _, a := range getAccounts() {
+		accounts = append(accounts, createAccountMessage(a).Data)
+	}
+	writeJSON(w, http.StatusOK, accounts)
+}
+
+// httpChat contains a chat and its unread counts
+type httpChat struct {
+	chatListData
+	Unread   int64 `json:"unread"`
+	Mentions int64 `json:"mentions"`
+}
+
+// handleHTTPChats handles a request for the chat list of account a
+func handleHTTPChats(w http.ResponseWriter, _ *http.Request, a *account) {
+	buddies, err := a.client.getBuddies()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	chats := []*httpChat{}
+	for _, b := range buddies {
+		u := a.client.getUnread(b.user)
+		chats = append(chats, &httpChat{
+			chatListData: chatListData{
+				Account: a.ID,
+				Chat:    b.user,
+				Alias:   b.name,
+				Nick:    a.client.username,
+			},
+			Unread:   u.msgs,
+			Mentions: u.mentions,
+		})
+	}
+	writeJSON(w, http.StatusOK, chats)
+}
+
+// handleHTTPChatUsers handles a request for the users of a chat of account a
+func handleHTTPChatUsers(w http.ResponseWriter, r *http.Request, a *account) {
+	channel := r.PathValue("chat")
+	filter := r.URL.Query().Get("filter")
+	users, err := a.client.getChannelUsers(r.Context(), channel, filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	chatUsers := []*chatUserData{}
+	for _, u := range users {
+		chatUsers = append(chatUsers, &chatUserData{
+			Account: a.ID,
+			Chat:    channel,
+			User:    u.user,
+			Alias:   u.name,
+			Status:  u.status,
+		})
+	}
+	writeJSON(w, http.StatusOK, chatUsers)
+}
+
+// handleHTTPChatSend handles a request to send a message to a chat of
+// account a
+func handleHTTPChatSend(w http.ResponseWriter, r *http.Request, a *account) {
+	channel := r.PathValue("chat")
+	var msg textData
+	if err := readJSON(r, &msg); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := a.client.sendMsg(r.Context(), channel, msg.Message); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeInfo(w, "sent message to %s.", channel)
+}
+
+// handleHTTPChatJoin handles a request to join a chat on account a
+func handleHTTPChatJoin(w http.ResponseWriter, r *http.Request, a *account) {
+	channel := r.PathValue("chat")
+	if err := a.client.joinChannel(r.Context(), channel); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeInfo(w, "joined chat %s.", channel)
+}
+
+// handleHTTPChatPart handles a request to leave a chat on account a
+func handleHTTPChatPart(w http.ResponseWriter, r *http.Request, a *account) {
+	channel := r.PathValue("chat")
+	if err := a.client.partChannel(r.Context(), channel); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeInfo(w, "left chat %s.", channel)
+}
+
+// handleHTTPChatRead handles a request to mark a chat on account a as read
+func handleHTTPChatRead(w http.ResponseWriter, r *http.Request, a *account) {
+	channel := r.PathValue("chat")
+	if err := a.client.readChannel(r.Context(), channel); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeInfo(w, "marked chat %s as read.", channel)
+}
+
+// handleHTTPHistory handles a request for the message history of account a
+func handleHTTPHistory(w http.ResponseWriter, _ *http.Request, a *account) {
+	history, err := a.client.getHistory()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	messages := []any{}
+	for _, msg := range history {
+		messages = append(messages, msg.Data)
+	}
+	writeJSON(w, http.StatusOK, messages)
+}
+
+// handleHTTPStatusGet handles a request for the status of account a
+func handleHTTPStatusGet(w http.ResponseWriter, r *http.Request, a *account) {
+	status, err := a.client.getStatus(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &statusData{a.ID, status})
+}
+
+// handleHTTPStatusSet handles a request to set the status of account a
+func handleHTTPStatusSet(w http.ResponseWriter, r *http.Request, a *account) {
+	var status statusData
+	if err := readJSON(r, &status); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := a.client.setStatus(r.Context(), status.Status); err != nil {
+		writeError(w, err)
+		return
+	}
+	handleHTTPStatusGet(w, r, a)
+}
+
+// handleHTTPEvents handles a request for the server-sent event stream of
+// live events, e.g., received messages
+func handleHTTPEvents(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	c := events.subscribe()
+	defer events.unsubscribe(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		logError(err)
+		return
+	}
+	for {
+		select {
+		case msg := <-c:
+			_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n",
+				msg.Type, msg.format(protocolJSON))
+			if err == nil {
+				err = rc.Flush()
+			}
+			if err != nil {
+				logError(err)
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// requireAuth returns a handler that passes requests on to h only if they
+// contain the auth secret as bearer token in the authorization header
+func requireAuth(secret string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		token, ok := strings.CutPrefix(auth, "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token),
+			[]byte(secret)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, &httpError{http.StatusUnauthorized,
+				errors.New("authentication required")})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// checkHTTPAuth checks that the http servers do not bypass the
+// authentication of the listeners: if a listener requires authentication,
+// the http servers require the global auth secret
+func checkHTTPAuth() error {
+	if conf.AuthSecret != "" {
+		return nil
+	}
+	for _, l := range conf.GetListeners() {
+		if conf.GetAuthSecret(&l) != "" {
+			return errors.New("http servers require AuthSecret " +
+				"if listeners require authentication")
+		}
+	}
+	return nil
+}
+
+// useHTTPTLS returns whether the http servers use TLS; they use TLS if it is
+// enabled globally or on any listener, so they do not serve the data of TLS
+// listeners in plaintext
+func useHTTPTLS() bool {
+	if conf.TLS {
+		return true
+	}
+	for _, l := range conf.GetListeners() {
+		if l.TLS {
+			return true
+		}
+	}
+	return false
+}
+
+// newHTTPHandler creates the http handler of the REST API; if an auth secret
+// is configured, requests must contain it as bearer token
+func newHTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /accounts", handleHTTPAccounts)
+	mux.HandleFunc("GET /accounts/{id}/chats",
+		handleAccount(handleHTTPChats))
+	mux.HandleFunc("GET /accounts/{id}/chats/{chat}/users",
+		handleAccount(handleHTTPChatUsers))
+	mux.HandleFunc("POST /accounts/{id}/chats/{chat}/messages",
+		handleAccount(handleHTTPChatSend))
+	mux.HandleFunc("POST /accounts/{id}/chats/{chat}/join",
+		handleAccount(handleHTTPChatJoin))
+	mux.HandleFunc("POST /accounts/{id}/chats/{chat}/part",
+		handleAccount(handleHTTPChatPart))
+	mux.HandleFunc("POST /accounts/{id}/chats/{chat}/read",
+		handleAccount(handleHTTPChatRead))
+	mux.HandleFunc("GET /accounts/{id}/history",
+		handleAccount(handleHTTPHistory))
+	mux.HandleFunc("GET /accounts/{id}/status",
+		handleAccount(handleHTTPStatusGet))
+	mux.HandleFunc("PUT /accounts/{id}/status",
+		handleAccount(handleHTTPStatusSet))
+	mux.HandleFunc("GET /events", handleHTTPEvents)
+	if conf.AuthSecret != "" {
+		return requireAuth(conf.AuthSecret, mux)
+	}
+	return mux
+}
+
+// startHTTPServer starts the http server called name on the address with
+// the handler h in the background; the server uses TLS if a listener uses
+// TLS
+func startHTTPServer(name, address string, h http.Handler) {
+	if err := checkHTTPAuth(); err != nil {
+		logFatal(err)
+	}
+	server := &http.Server{
+		Addr:              address,
+		Handler:           h,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+	}
+	useTLS := useHTTPTLS()
+	if useTLS {
+		config, err := getServerTLSConfig()
+		if err != nil {
+			logFatal(err)
+		}
+		server.TLSConfig = config
+	}
+	go func() {
+		logInfo(name, "server listening on", address)
+		var err error
+		if useTLS {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil {
+			logFatal(err)
+		}
+	}()
+}
+
+// runHTTPServer runs the http server of the REST API in the background if
+// it is enabled
+func runHTTPServer() {
+	if conf.HTTPAddress == "" {
+		return
+	}
+	startHTTPServer("HTTP", conf.HTTPAddress, newHTTPHandler())
+}
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+func TestGetHTTPStatus(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want int
+	}{
+		{&httpError{http.StatusBadRequest, errors.New("test")},
+			http.StatusBadRequest},
+		{errOffline, http.StatusServiceUnavailable},
+		{errChannelNotFound, http.StatusNotFound},
+		{errChannelAmbiguous, http.StatusConflict},
+		{model.NewAppError("test", "test", nil, "", http.StatusForbidden),
+			http.StatusForbidden},
+		{errors.New("test"), http.StatusInternalServerError},
+	} {
+		if got := getHTTPStatus(test.err); got != test.want {
+			t.Errorf("%v: got %d, wanted %d", test.err, got,
+				test.want)
+		}
+	}
+}
+
+func TestHTTPHandler(t *testing.T) {
+	accounts = make(map[int]*account)
+	defer func() {
+		// cleanup
+		accounts = make(map[int]*account)
+	}()
+	accounts[1] = &account{ID: 1, Protocol: "mattermost",
+		User: "user@server", client: &mattermost{}}
+	accounts[2] = &account{ID: 2, Protocol: "test"}
+
+	h := newHTTPHandler()
+	for _, test := range []struct {
+		method string
+		path   string
+		body   string
+		status int
+		want   string
+	}{
+		{"GET", "/accounts", "", http.StatusOK, `"user":"user@server"`},
+		{"GET", "/accounts/x/chats", "", http.StatusBadRequest,
+			"invalid account id"},
+		{"GET", "/accounts/3/chats", "", http.StatusNotFound,
+			"unknown account"},
+		{"GET", "/accounts/2/chats", "", http.StatusBadRequest,
+			"unsupported protocol"},
+		{"GET", "/accounts/1/chats", "", http.StatusServiceUnavailable,
+			"offline"},
+		{"POST", "/accounts/1/chats/team%2Fchat/messages", "invalid",
+			http.StatusBadRequest, "invalid"},
+		{"POST", "/accounts/1/chats/team%2Fchat/messages",
+			`{"message": "hi"}`, http.StatusServiceUnavailable,
+			"offline"},
+		{"DELETE", "/accounts", "", http.StatusMethodNotAllowed, ""},
+	} {
+		r := httptest.NewRequest(test.method, test.path,
+			strings.NewReader(test.body))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.status ||
+			!strings.Contains(w.Body.String(), test.want) {
+			t.Errorf("%s %s: got %d %q, wanted %d %q", test.method,
+				test.path, w.Code, w.Body.String(), test.status,
+				test.want)
+		}
+	}
+}
+
+func TestHTTPHandlerAuth(t *testing.T) {
+	conf.AuthSecret = "secret"
+	defer func() {
+		// cleanup
+		conf.AuthSecret = ""
+	}()
+
+	h := newHTTPHandler()
+	for _, test := range []struct {
+		auth   string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	} {
+		r := httptest.NewRequest("GET", "/accounts", nil)
+		if test.auth != "" {
+			r.Header.Set("Authorization", test.auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%q: got %d, wanted %d", test.auth, w.Code,
+				test.status)
+		}
+	}
+}
+
+func TestCheckHTTPAuth(t *testing.T) {
+	defer func() {
+		// cleanup
+		conf.AuthSecret = ""
+		conf.Listeners = nil
+	}()
+
+	// test listeners without authentication
+	conf.Listeners = []Listener{{Network: "tcp", Address: ":32000"}}
+	if err := checkHTTPAuth(); err != nil {
+		t.Errorf("got %v, wanted nil", err)
+	}
+
+	// test listener with authentication and no global auth secret
+	conf.Listeners[0].AuthSecret = "secret"
+	if err := checkHTTPAuth(); err == nil {
+		t.Errorf("got nil, wanted error")
+	}
+
+	// test global auth secret
+	conf.AuthSecret = "secret"
+	if err := checkHTTPAuth(); err != nil {
+		t.Errorf("got %v, wanted nil", err)
+	}
+}
+
+func TestUseHTTPTLS(t *testing.T) {
+	useTLS, listeners := conf.TLS, conf.Listeners
+	defer func() {
+		// cleanup
+		conf.TLS = useTLS
+		conf.Listeners = listeners
+	}()
+
+	for _, test := range []struct {
+		tls       bool
+		listeners []Listener
+		want      bool
+	}{
+		{false, nil, false},
+		{true, nil, true},
+		{false, []Listener{
+			{Network: "unix", Address: "test.sock"},
+			{Network: "tcp", Address: ":32000"},
+		}, false},
+		{false, []Listener{
+			{Network: "unix", Address: "test.sock"},
+			{Network: "tcp", Address: ":32000", TLS: true},
+		}, true},
+	} {
+		conf.TLS = test.tls
+		conf.Listeners = test.listeners
+		if got := useHTTPTLS(); got != test.want {
+			t.Errorf("%t %v: got %t, wanted %t", test.tls,
+				test.listeners, got, test.want)
+		}
+	}
+}
+
+func TestHTTPEvents(t *testing.T) {
+	s := httptest.NewServer(newHTTPHandler())
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r, err := http.NewRequestWithContext(ctx, "GET", s.URL+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// wait for subscription and publish event
+	for {
+		events.mutex.Lock()
+		n := len(events.subscribers)
+		events.mutex.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	events.publish(newInfoMessage("hello"))
+
+	// read event
+	br := bufio.NewReader(resp.Body)
+	want := []string{
+		"event: info\n",
+		`data: {"type":"info","data":{"message":"hello"}}` + "\n",
+		"\n",
+	}
+	for _, w := range want {
+		got, err := br.ReadString('\n')
+		if err != nil || got != w {
+			t.Errorf("got %q, %v, wanted %q", got, err, w)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package cmd
+
+import "net"
+
+// listen creates a listener on the network address; the permissions of unix
+// sockets are only set after they are created
+func listen(network, address string) (net.Listener, error) {
+	return net.Listen(network, address)
+}
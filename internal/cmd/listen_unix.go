@@ -0,0 +1,28 @@
+//go:build unix
+
+package cmd
+
+import (
+	"net"
+	"sync"
+	"syscall"
+)
+
+var (
+	// umaskMutex serializes changes of the process wide umask
+	umaskMutex sync.Mutex
+)
+
+// listen creates a listener on the network address; unix sockets are
+// created with a umask that only allows access by the current user, so they
+// never exist with more permissive permissions
+func listen(network, address string) (net.Listener, error) {
+	if network != "unix" {
+		return net.Listen(network, address)
+	}
+	umaskMutex.Lock()
+	defer umaskMutex.Unlock()
+	old := syscall.Umask(0077)
+	defer syscall.Umask(old)
+	return net.Listen(network, address)
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestListen(t *testing.T) {
+	// test unix socket permissions with a permissive umask
+	old := syscall.Umask(0)
+	defer syscall.Umask(old)
+	file := filepath.Join(t.TempDir(), "test.sock")
+	l, err := listen("unix", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		t.Errorf("got %o, wanted no group and other permissions", perm)
+	}
+
+	// test restored umask
+	if got := syscall.Umask(0); got != 0 {
+		t.Errorf("got %o, wanted 0", got)
+	}
+}
@@ -2,16 +2,45 @@ package cmd
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/mattermost/mattermost/server/public/model"
 )
 
+const (
+	// channelMembersPerPage is the number of channel members and users
+	// retrieved from the server with a single request
+	channelMembersPerPage = 200
+
+	// channelsPerPage is the number of channels retrieved from the server
+	// with a single request
+	channelsPerPage = 200
+)
+
+var (
+	// errChannelNotFound is returned if a channel cannot be resolved
+	errChannelNotFound = errors.New("channel not found")
+
+	// errChannelAmbiguous is returned if a channel name matches more
+	// than one channel
+	errChannelAmbiguous = errors.New("channel name is ambiguous")
+
+	// errOffline is returned if a command requires a connection to the
+	// server but the client is offline
+	errOffline = errors.New("account is offline")
+)
+
 // teamChannel contains a team's channel and its name
 type teamChannel struct {
 	channel *model.Channel
@@ -30,31 +59,64 @@ type mattermost struct {
 	client    *model.Client4
 	user      *model.User
 	websock   *model.WebSocketClient
-	done      chan bool
 	mutex     sync.Mutex
 	online    bool
-	history   []string
+	history   []*message
 	noHistory bool
 
 	// filterOwn toggles filtering of own messages
 	filterOwn bool
 
-	// httpPrefix is prepended to the server to form a http url
-	httpPrefix string
+	// keywords contains words that highlight messages
+	keywords []string
+
+	// catchUpLimit is the maximum number of old messages per channel
+	// retrieved on connect; 0 disables the limit
+	catchUpLimit uint
+
+	// displayName is the display name policy of message senders
+	displayName string
 
-	// webSocketPrefix is prepended to the server to form a websocket url
-	webSocketPrefix string
+	// webSocketURL is the websocket url of the server
+	webSocketURL string
+
+	// dialer is the dialer of websocket connections
+	dialer *websocket.Dialer
 
 	// teamChannels stores joined channels for each team
 	teamChannels teamChannels
 
 	// channels stores information of joined channels
 	channels *channels
+
+	// unread stores the unread counts of joined channels
+	unread *unreadCounts
+
+	// since is the time of the last online state change
+	since time.Time
+
+	// lastError is the last connection error
+	lastError string
+
+	// cancel stops the running client
+	cancel context.CancelFunc
+
+	// stopped is closed when the running client is stopped
+	stopped chan struct{}
+
+	// name is the account name derived from the server and teams
+	name string
 }
 
-// getErrorMessage converts an AppError to a string
-func getErrorMessage(err *model.AppError) string {
-	return err.Message + " " + err.Id + " " + err.DetailedError
+// getErrorMessage converts an error to a string; for an AppError, the string
+// includes its message, id and detailed error
+func getErrorMessage(err error) string {
+	var appErr *model.AppError
+	if !errors.As(err, &appErr) {
+		return err.Error()
+	}
+	return strings.TrimSpace(appErr.Message + " " + appErr.Id + " " +
+		appErr.DetailedError)
 }
 
 // splitTeamChannel splits a string that contains a team and a channel name
@@ -210,141 +272,419 @@ func (m *mattermost) getUser(ctx context.Context, name string) *model.User {
 	return m.getUserByUsername(ctx, name)
 }
 
-// createChannel creates a channel with name in team
-func (m *mattermost) createChannel(ctx context.Context, team *model.Team, name string) {
-	// create channel
-	c := &model.Channel{
-		DisplayName: name,
-		Name:        name,
-		Type:        model.ChannelTypePrivate,
-		TeamId:      team.Id,
+// matchTeamChannels returns the joined channels in tcs whose ID, name,
+// display name or alias matches name; if teamID is not empty, only channels
+// of this team are considered. Channels that are in several teams, e.g.,
+// direct channels, are only returned once
+func matchTeamChannels(tcs teamChannels, teamID, name string) []*model.Channel {
+	var matches []*model.Channel
+	seen := make(map[string]bool)
+	for t, channels := range tcs {
+		if teamID != "" && t.Id != teamID {
+			continue
+		}
+		for _, tc := range channels {
+			c := tc.channel
+			if seen[c.Id] {
+				continue
+			}
+			if c.Id != name && c.Name != name &&
+				!strings.EqualFold(c.DisplayName, name) &&
+				!strings.EqualFold(tc.name, name) {
+				continue
+			}
+			seen[c.Id] = true
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
+
+// getUniqueChannel returns the only channel in matches or an error if there
+// is no or more than one channel in matches
+func getUniqueChannel(name string, matches []*model.Channel) (*model.Channel, error) {
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", errChannelNotFound, name)
+	case 1:
+		return matches[0], nil
+	}
+	ids := make([]string, len(matches))
+	for i, c := range matches {
+		ids[i] = c.Id
 	}
-	_, _, err := m.client.CreateChannel(ctx, c)
+	return nil, fmt.Errorf("%w: %s matches channels %s", errChannelAmbiguous,
+		name, strings.Join(ids, ", "))
+}
+
+// findDirectChannel returns the direct channel with the channel name name in
+// tcs or nil if there is no such channel
+func findDirectChannel(tcs teamChannels, name string) *model.Channel {
+	for _, channels := range tcs {
+		for _, tc := range channels {
+			if tc.channel.Type == model.ChannelTypeDirect &&
+				tc.channel.Name == name {
+				return tc.channel
+			}
+		}
+	}
+	return nil
+}
+
+// getDirectChannel returns the direct channel with the user identified by
+// name; name can be a user ID, email address or username. If there is no
+// direct channel with the user, it is created if create is set
+func (m *mattermost) getDirectChannel(ctx context.Context, name string, create bool) (*model.Channel, error) {
+	u := m.getUser(ctx, name)
+	if u == nil {
+		return nil, fmt.Errorf("%w: unknown user %s", errChannelNotFound,
+			name)
+	}
+	dmName := model.GetDMNameFromIds(m.user.Id, u.Id)
+	if c := findDirectChannel(m.getTeamChannels(), dmName); c != nil {
+		return c, nil
+	}
+	if !create {
+		return nil, fmt.Errorf("%w: no direct channel with user %s",
+			errChannelNotFound, name)
+	}
+	c, _, err := m.client.CreateDirectChannel(ctx, m.user.Id, u.Id)
 	if err != nil {
-		logError(err)
+		return nil, err
 	}
+	return c, nil
 }
 
-// joinChannel joins channel identified by "<team>/<channel>" string
-// in teamChannel
-func (m *mattermost) joinChannel(ctx context.Context, teamChannel string) {
-	if !m.isOnline() {
-		return
+// resolveChannel identifies a channel by name and returns it; name can be a
+// channel ID, "@<user>" for the existing direct channel with a user, a
+// "<team>/<channel>" string, or a channel name, display name or alias of a
+// joined channel; channel names of channels that are not joined are looked up
+// in the first team of the current user. It returns an error if the channel
+// cannot be found or name matches more than one channel
+func (m *mattermost) resolveChannel(ctx context.Context, name string) (*model.Channel, error) {
+	return m.lookupChannel(ctx, name, false)
+}
+
+// resolveOrCreateChannel identifies a channel by name like resolveChannel
+// but creates the direct channel with a user if it does not exist
+func (m *mattermost) resolveOrCreateChannel(ctx context.Context, name string) (*model.Channel, error) {
+	return m.lookupChannel(ctx, name, true)
+}
+
+// lookupChannel identifies a channel by name, see resolveChannel; if
+// createDirect is set, missing direct channels with users are created
+func (m *mattermost) lookupChannel(ctx context.Context, name string, createDirect bool) (*model.Channel, error) {
+	// try to find channel by id
+	if c := m.getChannelByID(ctx, name); c != nil {
+		return c, nil
 	}
 
-	// get team and channel name
-	team, channel := m.splitTeamChannel(teamChannel)
+	// try to find direct channel with user
+	if user, ok := strings.CutPrefix(name, "@"); ok {
+		return m.getDirectChannel(ctx, user, createDirect)
+	}
+
+	// try to find joined channel by its full name
+	matches := matchTeamChannels(m.getTeamChannels(), "", name)
+	if len(matches) > 0 {
+		return getUniqueChannel(name, matches)
+	}
 
-	// get team id
+	// try to find channel in team
+	team, channel := m.splitTeamChannel(name)
+	if channel == "" {
+		return nil, fmt.Errorf("%w: %s", errChannelNotFound, name)
+	}
 	t := m.getTeam(ctx, team)
 	if t == nil {
-		logError("could not get team:", team, teamChannel)
-		return
+		return nil, fmt.Errorf("%w: unknown team %s", errChannelNotFound,
+			team)
 	}
-
-	// check if channel already exists
-	c := m.getChannel(ctx, t.Id, channel)
-	if c == nil {
-		// channel does not seem to exist, try to create it
-		m.createChannel(ctx, t, channel)
-		return
+	if team != "" {
+		matches = matchTeamChannels(m.getTeamChannels(), t.Id, channel)
+		if len(matches) > 0 {
+			return getUniqueChannel(name, matches)
+		}
 	}
+	if c := m.getChannelByName(ctx, t.Id, channel); c != nil {
+		return c, nil
+	}
+	return nil, fmt.Errorf("%w: %s", errChannelNotFound, name)
+}
 
-	// channel exist, add current user to channel
-	_, _, err := m.client.AddChannelMember(ctx, c.Id, m.user.Id)
-	if err != nil {
-		logError(err)
-		return
+// getChannelType converts the channel type name typ to a channel type
+func getChannelType(typ string) (model.ChannelType, error) {
+	switch typ {
+	case "public":
+		return model.ChannelTypeOpen, nil
+	case "private":
+		return model.ChannelTypePrivate, nil
+	default:
+		return "", fmt.Errorf("invalid channel type %s", typ)
 	}
 }
 
-// partChannel leaves channel
-func (m *mattermost) partChannel(ctx context.Context, teamChannel string) {
+// createChannel creates a channel identified by a "<team>/<channel>" string
+// in name with channel type typ ("public" or "private") and displayName; if
+// displayName is empty, the channel name is used as display name
+func (m *mattermost) createChannel(ctx context.Context, name, typ, displayName string) (*model.Channel, error) {
 	if !m.isOnline() {
-		return
+		return nil, errOffline
+	}
+
+	// get channel type
+	channelType, err := getChannelType(typ)
+	if err != nil {
+		return nil, err
 	}
 
 	// get team and channel name
-	team, channel := m.splitTeamChannel(teamChannel)
+	team, channel := m.splitTeamChannel(name)
+	if !model.IsValidChannelIdentifier(channel) {
+		return nil, fmt.Errorf("invalid channel name %s", channel)
+	}
+	t := m.getTeam(ctx, team)
+	if t == nil {
+		return nil, fmt.Errorf("unknown team %s", team)
+	}
+	if displayName == "" {
+		displayName = channel
+	}
+
+	// create channel
+	c := &model.Channel{
+		DisplayName: displayName,
+		Name:        channel,
+		Type:        channelType,
+		TeamId:      t.Id,
+	}
+	c, _, err = m.client.CreateChannel(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// browseChannels returns the public channels in team that the current user
+// can join
+func (m *mattermost) browseChannels(ctx context.Context, team string) (*model.Team, []*model.Channel, error) {
+	if !m.isOnline() {
+		return nil, nil, errOffline
+	}
 
-	// get team id
+	// get team
 	t := m.getTeam(ctx, team)
 	if t == nil {
-		logError("could not get team:", team, teamChannel)
-		return
+		return nil, nil, fmt.Errorf("unknown team %s", team)
+	}
+
+	// get joined channels of team
+	joined := make(map[string]bool)
+	for tm, tcs := range m.getTeamChannels() {
+		if tm.Id != t.Id {
+			continue
+		}
+		for _, tc := range tcs {
+			joined[tc.channel.Id] = true
+		}
+	}
+
+	// get public channels of team
+	var channels []*model.Channel
+	for page := 0; ; page++ {
+		cs, _, err := m.client.GetPublicChannelsForTeam(ctx, t.Id,
+			page, channelsPerPage, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, c := range cs {
+			if !joined[c.Id] {
+				channels = append(channels, c)
+			}
+		}
+		if len(cs) < channelsPerPage {
+			return t, channels, nil
+		}
+	}
+}
+
+// getChannelInfo returns the channel identified by name, see resolveChannel
+func (m *mattermost) getChannelInfo(ctx context.Context, name string) (*model.Channel, error) {
+	if !m.isOnline() {
+		return nil, errOffline
+	}
+	return m.resolveChannel(ctx, name)
+}
+
+// patchChannel updates the channel identified by name, see resolveChannel,
+// with patch
+func (m *mattermost) patchChannel(ctx context.Context, name string, patch *model.ChannelPatch) error {
+	if !m.isOnline() {
+		return errOffline
 	}
 
 	// check if channel exists
-	c := m.getChannel(ctx, t.Id, channel)
-	if c == nil {
-		logError("could not get channel:", channel, teamChannel)
-		return
+	c, err := m.resolveChannel(ctx, name)
+	if err != nil {
+		return err
 	}
 
-	// remove current user from channel
-	_, err := m.client.RemoveUserFromChannel(ctx, c.Id, m.user.Id)
+	// update channel
+	_, _, err = m.client.PatchChannel(ctx, c.Id, patch)
+	return err
+}
+
+// archiveChannel archives the channel identified by name, see resolveChannel
+func (m *mattermost) archiveChannel(ctx context.Context, name string) error {
+	if !m.isOnline() {
+		return errOffline
+	}
+
+	// check if channel exists
+	c, err := m.resolveChannel(ctx, name)
 	if err != nil {
-		logError(err)
-		return
+		return err
 	}
+
+	// archive channel
+	_, err = m.client.DeleteChannel(ctx, c.Id)
+	return err
 }
 
-// addChannel adds user to channel
-func (m *mattermost) addChannel(ctx context.Context, teamChannel, user string) {
+// joinChannel joins the channel identified by name, see
+// resolveOrCreateChannel
+func (m *mattermost) joinChannel(ctx context.Context, name string) error {
 	if !m.isOnline() {
-		return
+		return errOffline
 	}
 
-	// get team and channel name
-	team, channel := m.splitTeamChannel(teamChannel)
+	// check if channel exists
+	c, err := m.resolveOrCreateChannel(ctx, name)
+	if err != nil {
+		return err
+	}
 
-	// get team id
-	t := m.getTeam(ctx, team)
-	if t == nil {
-		logError("could not get team:", team, teamChannel)
-		return
+	// the current user is always a member of its direct channels
+	if c.Type == model.ChannelTypeDirect {
+		return nil
+	}
+
+	// channel exist, add current user to channel
+	_, _, err = m.client.AddChannelMember(ctx, c.Id, m.user.Id)
+	return err
+}
+
+// partChannel leaves the channel identified by name, see resolveChannel
+func (m *mattermost) partChannel(ctx context.Context, name string) error {
+	if !m.isOnline() {
+		return errOffline
 	}
 
 	// check if channel exists
-	c := m.getChannel(ctx, t.Id, channel)
-	if c == nil {
-		logError("could not get channel:", channel, teamChannel)
-		return
+	c, err := m.resolveChannel(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	// remove current user from channel
+	_, err = m.client.RemoveUserFromChannel(ctx, c.Id, m.user.Id)
+	return err
+}
+
+// addChannel adds user to the channel identified by name, see resolveChannel
+func (m *mattermost) addChannel(ctx context.Context, name, user string) error {
+	if !m.isOnline() {
+		return errOffline
+	}
+
+	// get channel and user
+	c, u, err := m.getChannelAndUser(ctx, name, user)
+	if err != nil {
+		return err
+	}
+
+	// add user to channel
+	_, _, err = m.client.AddChannelMember(ctx, c.Id, u.Id)
+	return err
+}
+
+// getChannelAndUser returns the channel identified by name, see
+// resolveChannel, and the user identified by user, see getUser
+func (m *mattermost) getChannelAndUser(ctx context.Context, name, user string) (*model.Channel, *model.User, error) {
+	// check if channel exists
+	c, err := m.resolveChannel(ctx, name)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// get user id
 	u := m.getUser(ctx, user)
 	if u == nil {
-		logError("could not get user:", user)
-		return
+		return nil, nil, fmt.Errorf("unknown user %s", user)
 	}
+	return c, u, nil
+}
 
-	// add user to channel
-	_, _, err := m.client.AddChannelMember(ctx, c.Id, u.Id)
+// kickChannel removes the other user from the channel identified by name, see
+// resolveChannel
+func (m *mattermost) kickChannel(ctx context.Context, name, user string) error {
+	if !m.isOnline() {
+		return errOffline
+	}
+
+	// get channel and user
+	c, u, err := m.getChannelAndUser(ctx, name, user)
 	if err != nil {
-		logError(err)
-		return
+		return err
 	}
+	if u.Id == m.user.Id {
+		return errors.New("cannot kick yourself, leave the channel instead")
+	}
+
+	// remove user from channel
+	_, err = m.client.RemoveUserFromChannel(ctx, c.Id, u.Id)
+	return err
+}
+
+// setChannelAdmin grants or revokes the channel admin role of user in the
+// channel identified by name, see resolveChannel
+func (m *mattermost) setChannelAdmin(ctx context.Context, name, user string, admin bool) error {
+	if !m.isOnline() {
+		return errOffline
+	}
+
+	// get channel and user
+	c, u, err := m.getChannelAndUser(ctx, name, user)
+	if err != nil {
+		return err
+	}
+
+	// update channel roles of user
+	roles := model.ChannelUserRoleId
+	if admin {
+		roles += " " + model.ChannelAdminRoleId
+	}
+	_, err = m.client.UpdateChannelRoles(ctx, c.Id, u.Id, roles)
+	return err
 }
 
 // getStatus returns our status
-func (m *mattermost) getStatus(ctx context.Context) string {
+func (m *mattermost) getStatus(ctx context.Context) (string, error) {
 	if !m.isOnline() {
-		return "offline"
+		return "offline", nil
 	}
 
 	status, _, err := m.client.GetUserStatus(ctx, m.user.Id, "")
 	if err != nil {
-		logError(err)
-		return ""
+		return "", err
 	}
-	return status.Status
+	return status.Status, nil
 }
 
 // setStatus sets our status
-func (m *mattermost) setStatus(ctx context.Context, status string) {
+func (m *mattermost) setStatus(ctx context.Context, status string) error {
 	if !m.isOnline() {
-		return
+		return errOffline
 	}
 
 	// check if status is valid:
@@ -355,7 +695,8 @@ func (m *mattermost) setStatus(ctx context.Context, status string) {
 	case "offline":
 	case "dnd":
 	default:
-		return // invalid status
+		return fmt.Errorf("invalid status %s, valid status: "+
+			"online, away, offline, dnd", status)
 	}
 
 	// set status
@@ -364,47 +705,133 @@ func (m *mattermost) setStatus(ctx context.Context, status string) {
 		Status: status,
 	}
 	_, _, err := m.client.UpdateUserStatus(ctx, m.user.Id, &s)
-	if err != nil {
+	return err
+}
+
+// getChannelMemberIDs returns the user IDs of all members of channel
+func (m *mattermost) getChannelMemberIDs(ctx context.Context, channel string) ([]string, error) {
+	var ids []string
+	for page := 0; ; page++ {
+		members, _, err := m.client.GetChannelMembers(ctx, channel,
+			page, channelMembersPerPage, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			ids = append(ids, member.UserId)
+		}
+		if len(members) < channelMembersPerPage {
+			return ids, nil
+		}
+	}
+}
+
+// getUsersByIDs returns the users identified by ids; if retrieving the users
+// in bulk fails, it falls back to retrieving them one by one and skips users
+// that cannot be retrieved
+func (m *mattermost) getUsersByIDs(ctx context.Context, ids []string) []*model.User {
+	var users []*model.User
+	for len(ids) > 0 {
+		batch := ids[:min(len(ids), channelMembersPerPage)]
+		ids = ids[len(batch):]
+
+		// try to get all users of the batch at once
+		u, _, err := m.client.GetUsersByIds(ctx, batch)
+		if err == nil {
+			users = append(users, u...)
+			continue
+		}
 		logError(err)
+
+		// fall back to getting users individually
+		for _, id := range batch {
+			user, _, err := m.client.GetUser(ctx, id, "")
+			if err != nil {
+				logError(err)
+				continue
+			}
+			users = append(users, user)
+		}
 	}
+	return users
 }
 
-// getChannelUsers returns a list of users in channel
-func (m *mattermost) getChannelUsers(ctx context.Context, channel string) []*buddy {
+// getUsersStatuses returns a mapping from user ID to status for users; users
+// whose status cannot be retrieved are missing in the mapping
+func (m *mattermost) getUsersStatuses(ctx context.Context, users []*model.User) map[string]string {
+	statuses := make(map[string]string)
+	for len(users) > 0 {
+		batch := users[:min(len(users), channelMembersPerPage)]
+		users = users[len(batch):]
+
+		ids := make([]string, len(batch))
+		for i, u := range batch {
+			ids[i] = u.Id
+		}
+		s, _, err := m.client.GetUsersStatusesByIds(ctx, ids)
+		if err != nil {
+			logError(err)
+			continue
+		}
+		for _, status := range s {
+			statuses[status.UserId] = status.Status
+		}
+	}
+	return statuses
+}
+
+// filterUsers returns the users whose username starts with prefix; the
+// comparison is case-insensitive and an empty prefix matches all users
+func filterUsers(users []*model.User, prefix string) []*model.User {
+	if prefix == "" {
+		return users
+	}
+	prefix = strings.ToLower(prefix)
+	var filtered []*model.User
+	for _, u := range users {
+		if strings.HasPrefix(strings.ToLower(u.Username), prefix) {
+			filtered = append(filtered, u)
+		}
+	}
+	return filtered
+}
+
+// getChannelUsers returns a list of users in the channel identified by name,
+// see resolveChannel, whose username starts with filter
+func (m *mattermost) getChannelUsers(ctx context.Context, name, filter string) ([]*buddy, error) {
 	var buddies []*buddy
 
 	if !m.isOnline() {
-		return buddies
+		return nil, errOffline
+	}
+
+	// check if channel exists
+	c, err := m.resolveChannel(ctx, name)
+	if err != nil {
+		return nil, err
 	}
 
 	// retrieve channel members
-	members, _, err := m.client.GetChannelMembers(ctx, channel, 0, 60, "")
+	ids, err := m.getChannelMemberIDs(ctx, c.Id)
 	if err != nil {
-		logError(err)
-		return nil
+		return nil, err
 	}
 
-	// try to get user information of channel members
-	for _, member := range members {
-		// user name
-		user, _, err := m.client.GetUser(ctx, member.UserId, "")
-		if err != nil {
-			logError(err)
-			return nil
-		}
-		// user status
-		status, _, err := m.client.GetUserStatus(ctx, user.Id, "")
-		if err != nil {
-			logError(err)
-			return nil
+	// try to get user information and status of channel members
+	users := filterUsers(m.getUsersByIDs(ctx, ids), filter)
+	statuses := m.getUsersStatuses(ctx, users)
+	for _, user := range users {
+		status := statuses[user.Id]
+		if status == "" {
+			status = model.StatusOffline
 		}
 
 		// add user to list
-		b := newBuddy(user.Id, user.Username, status.Status)
+		b := newBuddy(user.Id, user.Username, status)
 		buddies = append(buddies, b)
 	}
 
-	return buddies
+	return buddies, nil
 }
 
 // getChannelName returns the name of the channel c
@@ -433,11 +860,11 @@ func (m *mattermost) getChannelName(ctx context.Context, c *model.Channel) strin
 }
 
 // getBuddies returns a list of teams and channels the user is in
-func (m *mattermost) getBuddies() []*buddy {
+func (m *mattermost) getBuddies() ([]*buddy, error) {
 	var buddies []*buddy
 
 	if !m.isOnline() {
-		return buddies
+		return nil, errOffline
 	}
 
 	for _, teamChannels := range m.getTeamChannels() {
@@ -451,23 +878,103 @@ func (m *mattermost) getBuddies() []*buddy {
 		}
 	}
 
-	return buddies
+	return buddies, nil
+}
+
+// getOnlineBuddies returns the buddies whose chats are online: group chats
+// and direct chats with users that are online
+func (m *mattermost) getOnlineBuddies(ctx context.Context) ([]*buddy, error) {
+	buddies, err := m.getBuddies()
+	if err != nil {
+		return nil, err
+	}
+
+	// get the other users of direct channels and their statuses
+	others := make(map[string]string)
+	var users []*model.User
+	for _, teamChannels := range m.getTeamChannels() {
+		for _, tc := range teamChannels {
+			c := tc.channel
+			if c.Type != model.ChannelTypeDirect {
+				continue
+			}
+			if _, ok := others[c.Id]; ok {
+				continue
+			}
+			other := c.GetOtherUserIdForDM(m.user.Id)
+			others[c.Id] = other
+			users = append(users, &model.User{Id: other})
+		}
+	}
+	statuses := m.getUsersStatuses(ctx, users)
+	return filterOnlineBuddies(buddies, others, statuses), nil
+}
+
+// filterOnlineBuddies returns the buddies that are group chats or direct
+// chats with online users; others maps direct channel IDs to the other
+// users and statuses maps user IDs to statuses
+func filterOnlineBuddies(buddies []*buddy, others, statuses map[string]string) []*buddy {
+	var online []*buddy
+	for _, b := range buddies {
+		other, ok := others[b.user]
+		if ok && statuses[other] != model.StatusOnline {
+			continue
+		}
+		online = append(online, b)
+	}
+	return online
 }
 
-// sendMsg sends a message to channel
-func (m *mattermost) sendMsg(ctx context.Context, channel string, msg string) {
+// sendMsg sends a message to the channel identified by name, see
+// resolveOrCreateChannel
+func (m *mattermost) sendMsg(ctx context.Context, name string, msg string) error {
 	if !m.isOnline() {
-		return
+		return errOffline
+	}
+
+	// check if channel exists
+	c, err := m.resolveOrCreateChannel(ctx, name)
+	if err != nil {
+		return err
 	}
 
 	post := &model.Post{
-		ChannelId: channel,
+		ChannelId: c.Id,
 		Message:   msg,
 	}
 
-	if _, _, err := m.client.CreatePost(ctx, post); err != nil {
-		logError(err)
+	if _, _, err = m.client.CreatePost(ctx, post); err != nil {
+		return err
 	}
+	m.countMetric(metrics.messagesSent)
+	return nil
+}
+
+// getUnread returns the unread count of the channel identified by chanID
+func (m *mattermost) getUnread(chanID string) unreadCount {
+	return m.unread.get(chanID)
+}
+
+// readChannel marks the channel identified by name as read, see
+// resolveChannel
+func (m *mattermost) readChannel(ctx context.Context, name string) error {
+	if !m.isOnline() {
+		return errOffline
+	}
+
+	c, err := m.resolveChannel(ctx, name)
+	if err != nil {
+		return err
+	}
+	view := &model.ChannelView{
+		ChannelId:                 c.Id,
+		CollapsedThreadsSupported: true,
+	}
+	if _, _, err := m.client.ViewChannel(ctx, m.user.Id, view); err != nil {
+		return err
+	}
+	m.unread.clear(c.Id)
+	return nil
 }
 
 // isOnline checks if the mattermost client is online
@@ -480,8 +987,51 @@ func (m *mattermost) isOnline() bool {
 // setOnline sets the online state of the mattermost client
 func (m *mattermost) setOnline(online bool) {
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	changed := m.online != online
 	m.online = online
+	if changed {
+		m.since = time.Now()
+	}
+	if online {
+		m.lastError = ""
+	}
+	m.mutex.Unlock()
+
+	// run online and offline hooks
+	if !changed {
+		return
+	}
+	event := hookEventOffline
+	if online {
+		event = hookEventOnline
+	}
+	runHooks(&hookEvent{Event: event, Account: m.accountID})
+}
+
+// countMetric increments the metric of the mattermost account
+func (m *mattermost) countMetric(metric *metric) {
+	metrics.add(metric, 1, "account", strconv.Itoa(m.accountID))
+}
+
+// setLastError logs the connection error err and sets it as last error
+func (m *mattermost) setLastError(err error) {
+	msg := getErrorMessage(err)
+	logError(msg)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.lastError = msg
+}
+
+// getHealth returns the connection health of the mattermost client: its
+// online state, the unix time of the last online state change and the last
+// connection error
+func (m *mattermost) getHealth() (online bool, since int64, lastError string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.since.IsZero() {
+		since = m.since.Unix()
+	}
+	return m.online, since, m.lastError
 }
 
 // setTeamChannels sets the map of teams and their channels
@@ -509,6 +1059,7 @@ func (m *mattermost) updateTeamChannels(ctx context.Context) bool {
 
 	// get channels
 	teamChannels := make(teamChannels)
+	unread := make(map[string]unreadCount)
 	for _, t := range teams {
 		// get channels
 		channels, _, err := m.client.GetChannelsForTeamForUser(
@@ -518,6 +1069,15 @@ func (m *mattermost) updateTeamChannels(ctx context.Context) bool {
 			return false
 		}
 
+		// get unread counts from channel members
+		members, _, err := m.client.GetChannelMembersForUser(
+			ctx, m.user.Id, t.Id, "")
+		if err != nil {
+			logError(err)
+			return false
+		}
+		maps.Copy(unread, getUnreadCounts(channels, members))
+
 		for _, c := range channels {
 			// get name of the channel
 			name := m.getChannelName(ctx, c) +
@@ -530,18 +1090,49 @@ func (m *mattermost) updateTeamChannels(ctx context.Context) bool {
 
 	// update teams and channels
 	m.setTeamChannels(teamChannels)
+	m.unread.set(unread)
+	m.setName(getDefaultName(m.server, teams))
 
 	return true
 }
 
+// getDefaultName returns the default account name of the server and teams,
+// e.g., "chat.example.com/team1,team2"
+func getDefaultName(server string, teams []*model.Team) string {
+	host := getServerHost(server)
+	if len(teams) == 0 {
+		return host
+	}
+	names := make([]string, len(teams))
+	for i, t := range teams {
+		names[i] = t.Name
+	}
+	slices.Sort(names)
+	return host + "/" + strings.Join(names, ",")
+}
+
+// setName sets the account name derived from the server and teams
+func (m *mattermost) setName(name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.name = name
+}
+
+// getName returns the account name derived from the server and teams; it is
+// empty before the first login
+func (m *mattermost) getName() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.name
+}
+
 // addHistory adds msg to the account history
-func (m *mattermost) addHistory(msg string) {
+func (m *mattermost) addHistory(msg *message) {
 	if m.noHistory {
 		return
 	}
-	// only add "chat: msg:" or "message:" messages
-	if !strings.HasPrefix(msg, "chat: msg:") &&
-		!strings.HasPrefix(msg, "message:") {
+	// only add chat msg messages
+	if msg.Type != messageChatMsg {
 		return
 	}
 	m.mutex.Lock()
@@ -549,29 +1140,23 @@ func (m *mattermost) addHistory(msg string) {
 	m.history = append(m.history, msg)
 }
 
-// getHistory retrieves the account histoy
-func (m *mattermost) getHistory() {
+// getHistory returns the account history
+func (m *mattermost) getHistory() ([]*message, error) {
 	if m.noHistory {
-		return
+		return nil, errors.New("message history is disabled")
 	}
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-
-	// send all messages to client
-	for _, msg := range m.history {
-		clientQueue.send(msg)
-	}
+	return slices.Clone(m.history), nil
 }
 
-// getPostFiles returns the files attached to post as a string
-func (m *mattermost) getPostFiles(ctx context.Context, post *model.Post) string {
-	// return empty string if there are no files attached
-	if len(post.Metadata.Files) == 0 {
-		return ""
+// getPostFiles returns the files attached to post
+func (m *mattermost) getPostFiles(ctx context.Context, post *model.Post) []*postFile {
+	if post.Metadata == nil {
+		return nil
 	}
 
-	// construct and return file info string
-	fileInfo := "---- Attachments:"
+	var files []*postFile
 	for _, f := range post.Metadata.Files {
 		// create link for the file
 		link, _, err := m.client.GetFileLink(ctx, f.Id)
@@ -579,54 +1164,134 @@ func (m *mattermost) getPostFiles(ctx context.Context, post *model.Post) string
 			logError(err)
 			continue
 		}
+		files = append(files, &postFile{
+			ID:       f.Id,
+			Name:     f.Name,
+			MimeType: f.MimeType,
+			Size:     f.Size,
+			Link:     link,
+		})
+	}
+	return files
+}
 
-		// attach link to file name if present
-		fileInfo += fmt.Sprintf(
-			"\n* Name: %s\n  Type: %s\n  Size: %dB\n  Link: %s",
-			f.Name, f.MimeType, f.Size, link)
+// handleHighlight checks if the post sent by the user identified by username
+// should be highlighted and notifies the client; mentions contains the ids of
+// the mentioned users or nil if they are not available and catchUp indicates
+// an old post retrieved on connect
+func (m *mattermost) handleHighlight(post *model.Post, username string,
+	mentions []string, catchUp bool) {
+
+	// do not highlight own messages
+	if post.UserId == m.user.Id {
+		return
 	}
-	return fileInfo
+
+	chatType := m.getChatType(post.ChannelId)
+	direct := chatType == model.ChannelTypeDirect
+	reason := getHighlight(post.Message, direct, mentions, m.user,
+		m.keywords)
+	if reason == "" {
+		return
+	}
+
+	// send notification to the client and subscribers
+	sendEvent(newChatNotifyMessage(&chatNotifyData{
+		Account:   m.accountID,
+		Chat:      post.ChannelId,
+		PostID:    post.Id,
+		Timestamp: post.CreateAt / 1000,
+		Sender:    username,
+		Reason:    reason,
+	}))
+
+	// run mention hooks
+	runHooks(&hookEvent{
+		Event:     hookEventMention,
+		Account:   m.accountID,
+		Chat:      post.ChannelId,
+		ChatType:  string(chatType),
+		Timestamp: post.CreateAt / 1000,
+		Sender:    username,
+		Message:   post.Message,
+		Reason:    reason,
+		CatchUp:   catchUp,
+	})
 }
 
-// handlePost handles the post
-func (m *mattermost) handlePost(ctx context.Context, post *model.Post) {
+// handlePost handles the post; mentions contains the ids of the users
+// mentioned in the post or nil if they are not available and catchUp
+// indicates an old post retrieved on connect
+func (m *mattermost) handlePost(ctx context.Context, post *model.Post,
+	mentions []string, catchUp bool) {
+
 	// filter own messages
 	if post.UserId == m.user.Id && m.filterOwn {
 		return
 	}
 
-	// construct message text including attached files
-	text := post.Message
-	if fileInfo := m.getPostFiles(ctx, post); fileInfo != "" {
-		if text != "" {
-			text += "\n\n"
-		}
-		text += fileInfo
-	}
+	d := &chatMsgData{
+		Account:   m.accountID,
+		Chat:      post.ChannelId,
+		PostID:    post.Id,
+		RootID:    post.RootId,
+		Timestamp: post.CreateAt / 1000,
+		SenderID:  post.UserId,
+		Sender:    post.UserId,
+		Own:       post.UserId == m.user.Id,
+		Message:   post.Message,
+		Files:     m.getPostFiles(ctx, post),
+		Props:     post.GetProps(),
+	}
+	text := d.getText()
 	logDebug("Message:", post.CreateAt, post.ChannelId,
 		post.UserId, text)
 
+	// get names of channel and team
+	if t, tc := m.getJoinedTeamChannel(post.ChannelId); tc != nil {
+		d.ChatName = tc.channel.Name
+		d.ChatAlias = tc.name
+		d.Team = t.Name
+	}
+
 	// get name of user who sent this message
-	username := post.UserId
-	if post.UserId == m.user.Id {
-		username = "<self>"
-	} else {
-		user, _, err := m.client.GetUser(ctx, post.UserId, "")
+	user := m.user
+	if !d.Own {
+		var err error
+		user, _, err = m.client.GetUser(ctx, post.UserId, "")
 		if err != nil {
 			logError(err)
-		} else {
-			username = user.Username
 		}
 	}
+	if user != nil {
+		d.Sender = user.Username
+		d.SenderName = user.GetDisplayName(m.displayName)
+	}
+	username := d.Sender
+	if d.Own {
+		username = "<self>"
+	}
 
-	// construct message with format:
-	// chat: msg: <acc_id> <chat> <timestamp> <sender> <message>
-	// and send it via the client queue
-	msg := fmt.Sprintf("chat: msg: %d %s %d %s %s\r\n",
-		m.accountID, post.ChannelId, post.CreateAt/1000,
-		username, html.EscapeString(text))
+	// send message to the client and subscribers
+	if !d.Own {
+		m.countMetric(metrics.messagesReceived)
+	}
+	msg := newChatMsgMessage(d)
 	m.addHistory(msg)
-	clientQueue.send(msg)
+	sendEvent(msg)
+	m.handleHighlight(post, username, mentions, catchUp)
+
+	// run message hooks
+	runHooks(&hookEvent{
+		Event:     hookEventMessage,
+		Account:   m.accountID,
+		Chat:      post.ChannelId,
+		ChatType:  string(m.getChatType(post.ChannelId)),
+		Timestamp: post.CreateAt / 1000,
+		Sender:    username,
+		Message:   text,
+		CatchUp:   catchUp,
+	})
 
 	// save last post id of channel
 	m.channels.updatePostID(post.ChannelId, post.Id)
@@ -649,11 +1314,116 @@ func (m *mattermost) handleRemoved(event *model.WebSocketEvent) {
 	m.channels.deleteChannel(chanID)
 }
 
+// handlePostedUnread updates the unread counts for the posted event and its
+// post
+func (m *mattermost) handlePostedUnread(event *model.WebSocketEvent, post *model.Post) {
+	// the server marks the channel as read if we post a message
+	if post.UserId == m.user.Id {
+		m.unread.clear(post.ChannelId)
+		return
+	}
+	if m.getJoinedChannel(post.ChannelId) == nil {
+		return
+	}
+	m.unread.add(post.ChannelId, isMention(event, m.user.Id))
+}
+
+// handleChannelViewed handles channel viewed events, e.g., if channels were
+// read on another device
+func (m *mattermost) handleChannelViewed(event *model.WebSocketEvent) {
+	for _, id := range getViewedChannels(event) {
+		m.unread.clear(id)
+	}
+}
+
+// getChatType returns the type of the joined channel identified by its id or
+// an empty type if the channel is unknown
+func (m *mattermost) getChatType(id string) model.ChannelType {
+	if c := m.getJoinedChannel(id); c != nil {
+		return c.Type
+	}
+	return ""
+}
+
+// getJoinedTeamChannel returns the team and the joined channel identified by
+// its id or nil
+func (m *mattermost) getJoinedTeamChannel(id string) (*model.Team, *teamChannel) {
+	for t, tcs := range m.getTeamChannels() {
+		for _, tc := range tcs {
+			if tc.channel.Id == id {
+				return t, tc
+			}
+		}
+	}
+	return nil, nil
+}
+
+// getJoinedChannel returns the joined channel identified by its id or nil
+func (m *mattermost) getJoinedChannel(id string) *model.Channel {
+	if _, tc := m.getJoinedTeamChannel(id); tc != nil {
+		return tc.channel
+	}
+	return nil
+}
+
+// getChannelChanges returns descriptions of the changes from channel old to
+// channel updated
+func getChannelChanges(old, updated *model.Channel) []string {
+	var changes []string
+	for _, field := range []struct {
+		name     string
+		old, new string
+	}{
+		{"name", old.Name, updated.Name},
+		{"display name", old.DisplayName, updated.DisplayName},
+		{"header", old.Header, updated.Header},
+		{"purpose", old.Purpose, updated.Purpose},
+	} {
+		if field.old != field.new {
+			changes = append(changes, field.name+" changed to: "+
+				field.new)
+		}
+	}
+	return changes
+}
+
+// handleChannelUpdated handles channel updated events
+func (m *mattermost) handleChannelUpdated(event *model.WebSocketEvent) {
+	data, ok := event.GetData()["channel"].(string)
+	if !ok {
+		return
+	}
+	var updated *model.Channel
+	if err := json.Unmarshal([]byte(data), &updated); err != nil {
+		logError(err)
+		return
+	}
+	if updated == nil {
+		return
+	}
+
+	// compare updated channel with the known channel
+	old := m.getJoinedChannel(updated.Id)
+	if old == nil {
+		return
+	}
+	for _, change := range getChannelChanges(old, updated) {
+		sendEvent(newChatUpdateMessage(&chatUpdateData{
+			Account: m.accountID,
+			Chat:    updated.Id,
+			Change:  change,
+		}))
+	}
+}
+
 // handleTeamChannelChange handles team and channel change events
 func (m *mattermost) handleTeamChannelChange(ctx context.Context, event *model.WebSocketEvent) {
-	// handle removed events
-	if event.EventType() == model.WebsocketEventUserRemoved {
+	// handle removed and channel updated events
+	switch event.EventType() {
+	case model.WebsocketEventUserRemoved:
 		m.handleRemoved(event)
+	case model.WebsocketEventChannelUpdated:
+		m.handleChannelUpdated(event)
 	}
 
 	// update teams and channels
@@ -697,6 +1467,12 @@ func (m *mattermost) handleWebSocketEvent(ctx context.Context, event *model.WebS
 		model.WebsocketEventUserRemoved:
 		m.handleTeamChannelChange(ctx, event)
 		return
+
+	// handle channel viewed events
+	case websocketEventChannelViewed,
+		model.WebsocketEventMultipleChannelsViewed:
+		m.handleChannelViewed(event)
+		return
 	}
 
 	// only handle posted events from this point on
@@ -712,35 +1488,43 @@ func (m *mattermost) handleWebSocketEvent(ctx context.Context, event *model.WebS
 		return
 	}
 	if post != nil {
-		m.handlePost(ctx, post)
+		m.handlePostedUnread(event, post)
+		m.handlePost(ctx, post, getPostedMentions(event), false)
 	}
 }
 
 // getOldChannelMessages retrieves old/unread messages of the channel
-// identified by id
+// identified by id; if the catch-up limit is set, only the newest messages
+// up to the limit are handled
 func (m *mattermost) getOldChannelMessages(ctx context.Context, id string) {
 	// get last known post id of channel
 	postID := m.channels.getPostID(id)
+	var old []*model.Post
 	for {
 		// get batch of message after last know post id
 		posts, _, err := m.client.GetPostsAfter(ctx,
 			id, postID, 0, 60, "", false, true)
 		if err != nil {
 			logError(err)
-			return
+			break
 		}
 
 		// reverse message order
 		for i := len(posts.Order) - 1; i >= 0; i-- {
 			p := posts.Order[i]
-			m.handlePost(ctx, posts.Posts[p])
+			old = append(old, posts.Posts[p])
 			postID = p
-
+		}
+		if m.catchUpLimit > 0 && uint(len(old)) > m.catchUpLimit {
+			old = old[uint(len(old))-m.catchUpLimit:]
 		}
 		if posts.NextPostId == "" {
 			break
 		}
 	}
+	for _, post := range old {
+		m.handlePost(ctx, post, nil, true)
+	}
 }
 
 // getOldMessages retrieves old/unread messages
@@ -761,7 +1545,7 @@ func (m *mattermost) connect(ctx context.Context) bool {
 	defer cancelLogin()
 	user, _, err := m.client.Login(ctxLogin, m.username, m.password)
 	if err != nil {
-		logError(err)
+		m.setLastError(err)
 		return false
 	}
 	logInfo("Logged in as user", user.Username)
@@ -771,6 +1555,7 @@ func (m *mattermost) connect(ctx context.Context) bool {
 	ctxTeams, cancelTeams := context.WithTimeout(ctx, time.Minute)
 	defer cancelTeams()
 	if !m.updateTeamChannels(ctxTeams) {
+		m.setLastError(errors.New("cannot update teams and channels"))
 		return false
 	}
 
@@ -780,10 +1565,10 @@ func (m *mattermost) connect(ctx context.Context) bool {
 	m.getOldMessages(ctxMsgs)
 
 	// create websocket and start listening for events
-	websock, err := model.NewWebSocketClient4(m.webSocketPrefix+m.server,
-		m.client.AuthToken)
+	websock, err := model.NewWebSocketClient4WithDialer(m.dialer,
+		m.webSocketURL, m.client.AuthToken)
 	if err != nil {
-		logError(err)
+		m.setLastError(err)
 		return false
 	}
 	m.websock = websock
@@ -792,24 +1577,6 @@ func (m *mattermost) connect(ctx context.Context) bool {
 	return true
 }
 
-// connectWithCancel wraps the connect method and cancels a connection attempt
-// when mattermost is stopped.
-func (m *mattermost) connectWithCancel(ctx context.Context) bool {
-	result := make(chan bool)
-	ctxCancel, cancel := context.WithCancel(ctx)
-	defer cancel()
-	go func(ctx context.Context) {
-		result <- m.connect(ctx)
-	}(ctxCancel)
-	select {
-	case r := <-result:
-		return r
-	case <-m.done:
-		cancel()
-		return <-result
-	}
-}
-
 // loop runs the main loop of the mattermost client handling websocket events
 func (m *mattermost) loop(ctx context.Context) bool {
 	defer m.websock.Close()
@@ -823,7 +1590,7 @@ func (m *mattermost) loop(ctx context.Context) bool {
 				// log error if present, set client offline
 				// and return an error to trigger a reconnect
 				if err := m.websock.ListenError; err != nil {
-					logError(getErrorMessage(err))
+					m.setLastError(err)
 				}
 				m.setOnline(false)
 				return false
@@ -833,21 +1600,23 @@ func (m *mattermost) loop(ctx context.Context) bool {
 			m.handleWebSocketEvent(ctx, event)
 		case <-m.websock.PingTimeoutChannel:
 			logError("websocket ping timeout")
-		case <-m.done:
+		case <-ctx.Done():
 			return true
 		}
 	}
 }
 
-// run starts the mattermost client
+// run runs the mattermost client until ctx is done; the client is offline
+// when it returns
 func (m *mattermost) run(ctx context.Context) {
+	defer m.setOnline(false)
 	for {
 		// try to (re)connect to the server
-		for !m.connectWithCancel(ctx) {
+		for !m.connect(ctx) {
 			select {
 			case <-time.After(15 * time.Second):
 				// wait before reconnecting
-			case <-m.done:
+			case <-ctx.Done():
 				return
 			}
 		}
@@ -857,39 +1626,73 @@ func (m *mattermost) run(ctx context.Context) {
 		if m.loop(ctx) {
 			return
 		}
+		m.countMetric(metrics.reconnects)
 	}
 }
 
-// stop shuts down the mattermost client
+// start runs the mattermost client in the background until it is stopped
+func (m *mattermost) start(ctx context.Context) {
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.stopped = make(chan struct{})
+	go func() {
+		defer close(m.stopped)
+		m.run(ctx)
+	}()
+}
+
+// stop shuts down the mattermost client and waits until it is stopped, so
+// it does not use the account directory anymore
 func (m *mattermost) stop() {
-	m.done <- true
+	if m.cancel == nil {
+		// client was not started
+		return
+	}
+	m.cancel()
+	<-m.stopped
 }
 
-// newClient creates a new mattermost client
-func newClient(config *Config, accountID int, server, username,
-	password string) *mattermost {
+// newClient creates a new mattermost client for the server address or url
+// that stores its state in the account directory dir;
+// tlsConfig and proxy are used for api calls and websocket connections, nil
+// tlsConfig uses the default TLS configuration and nil proxy disables the
+// proxy
+func newClient(settings *clientSettings, accountID int, dir, server,
+	username, password string, tlsConfig *tls.Config,
+	proxy proxyFunc) *mattermost {
 
-	// configure encryption
-	httpPrefix := "https://"
-	webSocketPrefix := "wss://"
-	if config.DisableEncryption {
-		httpPrefix = "http://"
-		webSocketPrefix = "ws://"
-	}
+	// configure server urls and encryption
+	httpURL, webSocketURL := getServerURLs(server,
+		settings.disableEncryption)
 
 	m := mattermost{
 		accountID: accountID,
 		server:    server,
 		username:  username,
 		password:  password,
-		client:    model.NewAPIv4Client(httpPrefix + server),
-		done:      make(chan bool, 1),
-
-		filterOwn:       config.FilterOwn,
-		httpPrefix:      httpPrefix,
-		webSocketPrefix: webSocketPrefix,
-		noHistory:       config.DisableHistory,
-		channels:        newChannels(accountID),
+		client:    model.NewAPIv4Client(httpURL),
+
+		filterOwn:    settings.filterOwn,
+		keywords:     settings.keywords,
+		catchUpLimit: settings.catchUpLimit,
+		displayName:  settings.displayName,
+		webSocketURL: webSocketURL,
+		noHistory:    settings.disableHistory,
+		channels:     newChannels(dir),
+		unread:       newUnreadCounts(),
+	}
+
+	// configure TLS and proxy of api calls and websocket connections
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = proxy
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = tlsConfig
+	dialer.Proxy = proxy
+	m.dialer = &dialer
+
+	// record metrics of api calls
+	m.client.HTTPClient.Transport = &metricsTransport{
+		base: transport,
 	}
 	return &m
 }
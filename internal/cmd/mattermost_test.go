@@ -0,0 +1,348 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+func TestFilterUsers(t *testing.T) {
+	alice := &model.User{Username: "alice"}
+	albert := &model.User{Username: "Albert"}
+	bob := &model.User{Username: "bob"}
+	users := []*model.User{alice, albert, bob}
+
+	// test empty filter
+	want := users
+	got := filterUsers(users, "")
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+
+	// test case-insensitive prefix
+	want = []*model.User{alice, albert}
+	got = filterUsers(users, "AL")
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+
+	// test no match
+	want = nil
+	got = filterUsers(users, "carol")
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+func TestMatchTeamChannels(t *testing.T) {
+	team1 := &model.Team{Id: "team1"}
+	team2 := &model.Team{Id: "team2"}
+	general1 := &model.Channel{Id: "chan1", Name: "general",
+		DisplayName: "General"}
+	general2 := &model.Channel{Id: "chan2", Name: "general",
+		DisplayName: "General"}
+	direct := &model.Channel{Id: "chan3", Name: "user1__user2"}
+	tcs := teamChannels{
+		team1: {
+			{general1, "General (Team 1)"},
+			{direct, "user2 (Team 1)"},
+		},
+		team2: {
+			{general2, "General (Team 2)"},
+			{direct, "user2 (Team 2)"},
+		},
+	}
+
+	// test ambiguous display name
+	got := matchTeamChannels(tcs, "", "general")
+	if len(got) != 2 {
+		t.Errorf("got %d matches, wanted %d", len(got), 2)
+	}
+
+	// test display name in team
+	want := []*model.Channel{general2}
+	got = matchTeamChannels(tcs, "team2", "General")
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+
+	// test alias
+	want = []*model.Channel{general1}
+	got = matchTeamChannels(tcs, "", "general (team 1)")
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+
+	// test channel in several teams
+	want = []*model.Channel{direct}
+	got = matchTeamChannels(tcs, "", "chan3")
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+
+	// test no match
+	want = nil
+	got = matchTeamChannels(tcs, "", "random")
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+func TestGetUniqueChannel(t *testing.T) {
+	c1 := &model.Channel{Id: "chan1"}
+	c2 := &model.Channel{Id: "chan2"}
+
+	// test no channel
+	_, err := getUniqueChannel("test", nil)
+	if !errors.Is(err, errChannelNotFound) {
+		t.Errorf("got %v, wanted %v", err, errChannelNotFound)
+	}
+
+	// test single channel
+	got, err := getUniqueChannel("test", []*model.Channel{c1})
+	if got != c1 || err != nil {
+		t.Errorf("got %v, %v, wanted %v, %v", got, err, c1, nil)
+	}
+
+	// test multiple channels
+	_, err = getUniqueChannel("test", []*model.Channel{c1, c2})
+	if !errors.Is(err, errChannelAmbiguous) {
+		t.Errorf("got %v, wanted %v", err, errChannelAmbiguous)
+	}
+}
+
+func TestGetChannelType(t *testing.T) {
+	for typ, want := range map[string]model.ChannelType{
+		"public":  model.ChannelTypeOpen,
+		"private": model.ChannelTypePrivate,
+	} {
+		got, err := getChannelType(typ)
+		if got != want || err != nil {
+			t.Errorf("got %s, %v, wanted %s, %v", got, err, want, nil)
+		}
+	}
+
+	// test invalid type
+	if _, err := getChannelType("direct"); err == nil {
+		t.Errorf("got %v, wanted error", err)
+	}
+}
+
+func TestGetChannelChanges(t *testing.T) {
+	old := &model.Channel{
+		Name:        "test",
+		DisplayName: "Test",
+		Header:      "old header",
+	}
+
+	// test no changes
+	var want []string
+	got := getChannelChanges(old, old)
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+
+	// test changes
+	updated := &model.Channel{
+		Name:        "test",
+		DisplayName: "New Test",
+		Header:      "new header",
+		Purpose:     "new purpose",
+	}
+	want = []string{
+		"display name changed to: New Test",
+		"header changed to: new header",
+		"purpose changed to: new purpose",
+	}
+	got = getChannelChanges(old, updated)
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+func TestGetErrorMessage(t *testing.T) {
+	// test regular error
+	want := "test error"
+	got := getErrorMessage(errors.New(want))
+	if got != want {
+		t.Errorf("got %s, wanted %s", got, want)
+	}
+
+	// test app error
+	err := model.NewAppError("test", "test.id", nil, "details", 403)
+	err.Message = "test message"
+	want = "test message test.id details"
+	got = getErrorMessage(err)
+	if got != want {
+		t.Errorf("got %s, wanted %s", got, want)
+	}
+
+	// test wrapped app error without details
+	err = model.NewAppError("test", "test.id", nil, "", 403)
+	err.Message = "test message"
+	want = "test message test.id"
+	got = getErrorMessage(fmt.Errorf("wrapped: %w", err))
+	if got != want {
+		t.Errorf("got %s, wanted %s", got, want)
+	}
+}
+
+func TestGetDefaultName(t *testing.T) {
+	teams := []*model.Team{{Name: "team2"}, {Name: "team1"}}
+	for _, test := range []struct {
+		server string
+		teams  []*model.Team
+		want   string
+	}{
+		{"chat.example.com", nil, "chat.example.com"},
+		{"chat.example.com:8065", teams,
+			"chat.example.com:8065/team1,team2"},
+		{"https://chat.example.com/mm", teams[:1],
+			"chat.example.com/team2"},
+	} {
+		got := getDefaultName(test.server, test.teams)
+		if got != test.want {
+			t.Errorf("got %s, wanted %s", got, test.want)
+		}
+	}
+}
+
+func TestFilterOnlineBuddies(t *testing.T) {
+	buddies := []*buddy{
+		newBuddy("group", "group", "GROUP_CHAT"),
+		newBuddy("dm1", "dm1", "GROUP_CHAT"),
+		newBuddy("dm2", "dm2", "GROUP_CHAT"),
+		newBuddy("dm3", "dm3", "GROUP_CHAT"),
+	}
+	others := map[string]string{
+		"dm1": "user1",
+		"dm2": "user2",
+		"dm3": "user3",
+	}
+	statuses := map[string]string{
+		"user1": model.StatusOnline,
+		"user2": model.StatusAway,
+	}
+	want := []*buddy{buddies[0], buddies[1]}
+	got := filterOnlineBuddies(buddies, others, statuses)
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+func TestFindDirectChannel(t *testing.T) {
+	dmName := model.GetDMNameFromIds("user1", "user2")
+	dm := &model.Channel{Name: dmName, Type: model.ChannelTypeDirect}
+	open := &model.Channel{Name: dmName, Type: model.ChannelTypeOpen}
+	tcs := teamChannels{
+		&model.Team{}: {{open, "open"}, {dm, "dm"}},
+	}
+
+	// test existing direct channel
+	if got := findDirectChannel(tcs, dmName); got != dm {
+		t.Errorf("got %v, wanted %v", got, dm)
+	}
+
+	// test missing direct channel
+	other := model.GetDMNameFromIds("user1", "user3")
+	if got := findDirectChannel(tcs, other); got != nil {
+		t.Errorf("got %v, wanted nil", got)
+	}
+}
+
+func TestMattermostStartStop(t *testing.T) {
+	m := newClient(&clientSettings{}, 0, t.TempDir(), "127.0.0.1:1",
+		"user", "passwd", nil, nil)
+
+	// test stopping a client that was not started
+	m.stop()
+
+	// test stopping a running client waits until it is stopped
+	m.start(context.Background())
+	m.stop()
+	select {
+	case <-m.stopped:
+	default:
+		t.Errorf("client is still running")
+	}
+
+	// test stopping an online client sets it offline
+	m.start(context.Background())
+	m.setOnline(true)
+	m.stop()
+	if m.isOnline() {
+		t.Errorf("got online, wanted offline")
+	}
+}
+
+func TestJoinChannel(t *testing.T) {
+	me := model.NewId()
+	bob := &model.User{Id: model.NewId(), Username: "bob"}
+	dm := &model.Channel{Id: model.NewId(), Type: model.ChannelTypeDirect,
+		Name: model.GetDMNameFromIds(me, bob.Id)}
+	open := &model.Channel{Id: model.NewId(), Type: model.ChannelTypeOpen}
+
+	// mattermost server that rejects adding members to direct channels
+	var joined []string
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, v any) {
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Error(err)
+		}
+	}
+	mux.HandleFunc("GET /api/v4/users/username/bob",
+		func(w http.ResponseWriter, _ *http.Request) {
+			writeJSON(w, bob)
+		})
+	mux.HandleFunc("POST /api/v4/channels/direct",
+		func(w http.ResponseWriter, _ *http.Request) {
+			writeJSON(w, dm)
+		})
+	mux.HandleFunc("GET /api/v4/channels/"+open.Id,
+		func(w http.ResponseWriter, _ *http.Request) {
+			writeJSON(w, open)
+		})
+	mux.HandleFunc("POST /api/v4/channels/{id}/members",
+		func(w http.ResponseWriter, r *http.Request) {
+			joined = append(joined, r.PathValue("id"))
+			if r.PathValue("id") == dm.Id {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			writeJSON(w, &model.ChannelMember{})
+		})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	m := &mattermost{
+		client: model.NewAPIv4Client(s.URL),
+		user:   &model.User{Id: me},
+		online: true,
+	}
+	ctx := context.Background()
+
+	// test joining the direct channel with a user creates it and does not
+	// add the current user to it
+	if err := m.joinChannel(ctx, "@bob"); err != nil {
+		t.Errorf("got %v, wanted nil", err)
+	}
+	if len(joined) != 0 {
+		t.Errorf("got %v, wanted no joined channels", joined)
+	}
+
+	// test joining other channels adds the current user
+	if err := m.joinChannel(ctx, open.Id); err != nil {
+		t.Errorf("got %v, wanted nil", err)
+	}
+	if !slices.Equal(joined, []string{open.Id}) {
+		t.Errorf("got %v, wanted %v", joined, []string{open.Id})
+	}
+}
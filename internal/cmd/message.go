@@ -0,0 +1,440 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+)
+
+const (
+	// protocolNuqql is the nuqql line protocol
+	protocolNuqql = "nuqql"
+
+	// protocolJSON is the json lines protocol; each message and command
+	// is a json object on a single line
+	protocolJSON = "json"
+)
+
+// message types
+const (
+	messageInfo       = "info"
+	messageError      = "error"
+	messageVersion    = "version"
+	messageHelp       = "help"
+	messageAccount    = "account"
+	messageSetting    = "account_setting"
+	messageBuddy      = "buddy"
+	messageStatus     = "status"
+	messageChatList   = "chat_list"
+	messageChatUnread = "chat_unread"
+	messageChatBrowse = "chat_browse"
+	messageChatUser   = "chat_user"
+	messageChatField  = "chat_field"
+	messageChatUpdate = "chat_update"
+	messageChatMsg    = "chat_msg"
+	messageChatNotify = "chat_notify"
+)
+
+// message is a message for the client; it can be formatted in the nuqql line
+// protocol or as a json object
+type message struct {
+	// Type is the type of the message, e.g., "info" or "chat_msg"
+	Type string `json:"type"`
+
+	// Tag is the tag of the client command the message replies to
+	Tag string `json:"tag,omitempty"`
+
+	// Data contains the fields of the message, depending on its type
+	Data any `json:"data"`
+
+	// line is the message in the nuqql line protocol
+	line string
+}
+
+// withTag returns a copy of the message with the command tag set to tag
+func (m *message) withTag(tag string) *message {
+	c := *m
+	c.Tag = tag
+	return &c
+}
+
+// format formats the message in protocol
+func (m *message) format(protocol string) string {
+	if protocol == protocolJSON {
+		// encode message as a single line, the encoder appends "\n"
+		var b strings.Builder
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(m); err != nil {
+			logError(err)
+			return ""
+		}
+		return b.String()
+	}
+	if m.Tag != "" {
+		return tagMessage(m.Tag, m.line)
+	}
+	return m.line
+}
+
+// textData contains the fields of info and error messages
+type textData struct {
+	Message string `json:"message"`
+}
+
+// newInfoMessage creates a new info message with text
+func newInfoMessage(text string) *message {
+	return &message{
+		Type: messageInfo,
+		Data: &textData{text},
+		line: "info: " + text + "\r\n",
+	}
+}
+
+// newErrorMessage creates a new error message containing err
+func newErrorMessage(err error) *message {
+	text := getErrorMessage(err)
+	return &message{
+		Type: messageError,
+		Data: &textData{text},
+		line: "error: " + text + "\r\n",
+	}
+}
+
+// versionData contains the fields of version messages
+type versionData struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// newVersionMessage creates a new version message
+func newVersionMessage(name, version string) *message {
+	return &message{
+		Type: messageVersion,
+		Data: &versionData{name, version},
+		line: fmt.Sprintf("info: version: %s v%s\r\n", name, version),
+	}
+}
+
+// helpCommand contains the syntax and help of a command in help messages
+type helpCommand struct {
+	Syntax string `json:"syntax"`
+	Help   string `json:"help"`
+}
+
+// helpData contains the fields of help messages
+type helpData struct {
+	Commands []*helpCommand `json:"commands"`
+	Notes    string         `json:"notes,omitempty"`
+}
+
+// newHelpMessage creates a new help message for the commands cmds; notes
+// are appended if set
+func newHelpMessage(cmds []*command, notes bool) *message {
+	d := &helpData{}
+	line := helpHeader
+	for _, c := range cmds {
+		d.Commands = append(d.Commands, &helpCommand{c.syntax, c.help})
+		line += c.getHelp()
+	}
+	if notes {
+		d.Notes = helpNotes
+		line += strings.ReplaceAll(helpNotes, "\n", "\r\n") + "\r\n"
+	}
+	return &message{
+		Type: messageHelp,
+		Data: d,
+		line: line,
+	}
+}
+
+// accountData contains the fields of account messages
+type accountData struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	User     string `json:"user"`
+	Status   string `json:"status"`
+}
+
+// newAccountMessage creates a new account message
+func newAccountMessage(d *accountData) *message {
+	// account: <id> <name> <protocol> <user> <status>
+	return &message{
+		Type: messageAccount,
+		Data: d,
+		line: fmt.Sprintf("account: %d %s %s %s %s\r\n", d.ID, d.Name,
+			d.Protocol, d.User, d.Status),
+	}
+}
+
+// settingData contains the fields of account setting messages
+type settingData struct {
+	Account int    `json:"account"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Default bool   `json:"default"`
+}
+
+// newSettingMessage creates a new account setting message
+func newSettingMessage(d *settingData) *message {
+	// info: account <acc_id> setting <key>: <value> [(default)]
+	line := fmt.Sprintf("info: account %d setting %s: %s", d.Account,
+		d.Key, d.Value)
+	if d.Default {
+		line += " (default)"
+	}
+	return &message{
+		Type: messageSetting,
+		Data: d,
+		line: line + "\r\n",
+	}
+}
+
+// buddyData contains the fields of buddy messages
+type buddyData struct {
+	Account int    `json:"account"`
+	Status  string `json:"status"`
+	Name    string `json:"name"`
+	Alias   string `json:"alias"`
+}
+
+// newBuddyMessage creates a new buddy message
+func newBuddyMessage(d *buddyData) *message {
+	// buddy: <acc_id> status: <status> name: <name> alias: [alias]
+	return &message{
+		Type: messageBuddy,
+		Data: d,
+		line: fmt.Sprintf("buddy: %d status: %s name: %s alias: %s\r\n",
+			d.Account, d.Status, d.Name, url.PathEscape(d.Alias)),
+	}
+}
+
+// statusData contains the fields of status messages
+type statusData struct {
+	Account int    `json:"account"`
+	Status  string `json:"status"`
+}
+
+// newStatusMessage creates a new status message
+func newStatusMessage(d *statusData) *message {
+	// status: account <acc_id> status: <status>
+	return &message{
+		Type: messageStatus,
+		Data: d,
+		line: fmt.Sprintf("status: account %d status: %s\r\n",
+			d.Account, d.Status),
+	}
+}
+
+// chatListData contains the fields of chat list messages
+type chatListData struct {
+	Account int    `json:"account"`
+	Chat    string `json:"chat"`
+	Alias   string `json:"alias"`
+	Nick    string `json:"nick"`
+}
+
+// newChatListMessage creates a new chat list message
+func newChatListMessage(d *chatListData) *message {
+	// chat: list: <acc_id> <chat_id> <chat_alias> <nick>
+	return &message{
+		Type: messageChatList,
+		Data: d,
+		line: fmt.Sprintf("chat: list: %d %s %s %s\r\n", d.Account,
+			d.Chat, url.PathEscape(d.Alias), d.Nick),
+	}
+}
+
+// chatUnreadData contains the fields of chat unread messages
+type chatUnreadData struct {
+	Account  int    `json:"account"`
+	Chat     string `json:"chat"`
+	Unread   int64  `json:"unread"`
+	Mentions int64  `json:"mentions"`
+}
+
+// newChatUnreadMessage creates a new chat unread message
+func newChatUnreadMessage(d *chatUnreadData) *message {
+	// chat: unread: <acc_id> <chat_id> <unread> <mentions>
+	return &message{
+		Type: messageChatUnread,
+		Data: d,
+		line: fmt.Sprintf("chat: unread: %d %s %d %d\r\n", d.Account,
+			d.Chat, d.Unread, d.Mentions),
+	}
+}
+
+// chatBrowseData contains the fields of chat browse messages
+type chatBrowseData struct {
+	Account int    `json:"account"`
+	Chat    string `json:"chat"`
+	Team    string `json:"team"`
+	Name    string `json:"name"`
+	Alias   string `json:"alias"`
+}
+
+// newChatBrowseMessage creates a new chat browse message
+func newChatBrowseMessage(d *chatBrowseData) *message {
+	// chat: browse: <acc_id> <chat_id> <team>/<chat> <chat_alias>
+	return &message{
+		Type: messageChatBrowse,
+		Data: d,
+		line: fmt.Sprintf("chat: browse: %d %s %s/%s %s\r\n", d.Account,
+			d.Chat, d.Team, d.Name, url.PathEscape(d.Alias)),
+	}
+}
+
+// chatUserData contains the fields of chat user messages
+type chatUserData struct {
+	Account int    `json:"account"`
+	Chat    string `json:"chat"`
+	User    string `json:"user"`
+	Alias   string `json:"alias"`
+	Status  string `json:"status"`
+}
+
+// newChatUserMessage creates a new chat user message
+func newChatUserMessage(d *chatUserData) *message {
+	// chat: user: <acc_id> <chat> <name> <alias> <state>
+	return &message{
+		Type: messageChatUser,
+		Data: d,
+		line: fmt.Sprintf("chat: user: %d %s %s %s %s\r\n", d.Account,
+			d.Chat, d.User, url.PathEscape(d.Alias), d.Status),
+	}
+}
+
+// chatFieldData contains the fields of chat field messages, e.g., the header
+// or purpose of a chat
+type chatFieldData struct {
+	Account int    `json:"account"`
+	Chat    string `json:"chat"`
+	Field   string `json:"field"`
+	Value   string `json:"value"`
+}
+
+// newChatFieldMessage creates a new chat field message
+func newChatFieldMessage(d *chatFieldData) *message {
+	// info: account <acc_id> chat <chat> <field>: <value>
+	return &message{
+		Type: messageChatField,
+		Data: d,
+		line: fmt.Sprintf("info: account %d chat %s %s: %s\r\n",
+			d.Account, d.Chat, d.Field, html.EscapeString(d.Value)),
+	}
+}
+
+// chatUpdateData contains the fields of chat update messages
+type chatUpdateData struct {
+	Account int    `json:"account"`
+	Chat    string `json:"chat"`
+	Change  string `json:"change"`
+}
+
+// newChatUpdateMessage creates a new chat update message
+func newChatUpdateMessage(d *chatUpdateData) *message {
+	// info: account <acc_id> chat <chat>: <change>
+	return &message{
+		Type: messageChatUpdate,
+		Data: d,
+		line: fmt.Sprintf("info: account %d chat %s: %s\r\n",
+			d.Account, d.Chat, html.EscapeString(d.Change)),
+	}
+}
+
+// postFile contains information about a file attached to a post
+type postFile struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	Link     string `json:"link"`
+}
+
+// formatPostFiles returns the files attached to a post as a string
+func formatPostFiles(files []*postFile) string {
+	// return empty string if there are no files attached
+	if len(files) == 0 {
+		return ""
+	}
+
+	// construct and return file info string
+	fileInfo := "---- Attachments:"
+	for _, f := range files {
+		fileInfo += fmt.Sprintf(
+			"\n* Name: %s\n  Type: %s\n  Size: %dB\n  Link: %s",
+			f.Name, f.MimeType, f.Size, f.Link)
+	}
+	return fileInfo
+}
+
+// chatMsgData contains the fields of chat msg messages
+type chatMsgData struct {
+	Account    int            `json:"account"`
+	Chat       string         `json:"chat"`
+	ChatName   string         `json:"chat_name"`
+	ChatAlias  string         `json:"chat_alias"`
+	Team       string         `json:"team"`
+	PostID     string         `json:"post_id"`
+	RootID     string         `json:"root_id"`
+	Timestamp  int64          `json:"timestamp"`
+	SenderID   string         `json:"sender_id"`
+	Sender     string         `json:"sender"`
+	SenderName string         `json:"sender_name"`
+	Own        bool           `json:"own"`
+	Message    string         `json:"message"`
+	Files      []*postFile    `json:"files"`
+	Props      map[string]any `json:"props"`
+}
+
+// getText returns the message text including the attached files
+func (d *chatMsgData) getText() string {
+	text := d.Message
+	if fileInfo := formatPostFiles(d.Files); fileInfo != "" {
+		if text != "" {
+			text += "\n\n"
+		}
+		text += fileInfo
+	}
+	return text
+}
+
+// newChatMsgMessage creates a new chat msg message
+func newChatMsgMessage(d *chatMsgData) *message {
+	// chat: msg: <acc_id> <chat> <timestamp> <sender> <message>
+	sender := d.Sender
+	if d.Own {
+		sender = "<self>"
+	}
+	return &message{
+		Type: messageChatMsg,
+		Data: d,
+		line: fmt.Sprintf("chat: msg: %d %s %d %s %s\r\n", d.Account,
+			d.Chat, d.Timestamp, sender,
+			html.EscapeString(d.getText())),
+	}
+}
+
+// chatNotifyData contains the fields of chat notify messages
+type chatNotifyData struct {
+	Account   int    `json:"account"`
+	Chat      string `json:"chat"`
+	PostID    string `json:"post_id"`
+	Timestamp int64  `json:"timestamp"`
+	Sender    string `json:"sender"`
+	Reason    string `json:"reason"`
+}
+
+// newChatNotifyMessage creates a new chat notify message
+func newChatNotifyMessage(d *chatNotifyData) *message {
+	// chat: notify: <acc_id> <chat> <timestamp> <sender> <reason>
+	return &message{
+		Type: messageChatNotify,
+		Data: d,
+		line: fmt.Sprintf("chat: notify: %d %s %d %s %s\r\n", d.Account,
+			d.Chat, d.Timestamp, d.Sender, d.Reason),
+	}
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestMessageFormat(t *testing.T) {
+	m := newInfoMessage("hello")
+
+	// test nuqql protocol
+	want := "info: hello\r\n"
+	got := m.format(protocolNuqql)
+	if got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+
+	// test json protocol
+	want = `{"type":"info","data":{"message":"hello"}}` + "\n"
+	got = m.format(protocolJSON)
+	if got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+
+	// test tagged message, original message must not change
+	tagged := m.withTag("1")
+	want = "#1 info: hello\r\n"
+	got = tagged.format(protocolNuqql)
+	if got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+	want = `{"type":"info","tag":"1","data":{"message":"hello"}}` + "\n"
+	got = tagged.format(protocolJSON)
+	if got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+	if m.Tag != "" {
+		t.Errorf("got %q, wanted empty tag", m.Tag)
+	}
+}
+
+func TestNewErrorMessage(t *testing.T) {
+	m := newErrorMessage(errors.New("test error"))
+	want := "error: test error\r\n"
+	if got := m.format(protocolNuqql); got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+}
+
+func TestNewChatMsgMessage(t *testing.T) {
+	d := &chatMsgData{
+		Account:   1,
+		Chat:      "chat",
+		PostID:    "post",
+		Timestamp: 1234,
+		Sender:    "user",
+		Own:       true,
+		Message:   "<hi>",
+		Files: []*postFile{{
+			Name:     "file.txt",
+			MimeType: "text/plain",
+			Size:     42,
+			Link:     "link",
+		}},
+	}
+	m := newChatMsgMessage(d)
+
+	// test nuqql protocol
+	want := "chat: msg: 1 chat 1234 <self> &lt;hi&gt;\n\n" +
+		"---- Attachments:\n* Name: file.txt\n  Type: text/plain\n" +
+		"  Size: 42B\n  Link: link\r\n"
+	if got := m.format(protocolNuqql); got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+
+	// test json protocol
+	var got struct {
+		Type string
+		Data chatMsgData
+	}
+	if err := json.Unmarshal([]byte(m.format(protocolJSON)), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != messageChatMsg || got.Data.Message != d.Message ||
+		got.Data.Sender != d.Sender || got.Data.PostID != d.PostID ||
+		len(got.Data.Files) != 1 {
+		t.Errorf("got %+v, wanted %+v", got.Data, d)
+	}
+}
+
+func TestNewChatUserMessage(t *testing.T) {
+	m := newChatUserMessage(&chatUserData{
+		Account: 1,
+		Chat:    "chat",
+		User:    "user",
+		Alias:   "some user",
+		Status:  "online",
+	})
+	want := "chat: user: 1 chat user some%20user online\r\n"
+	if got := m.format(protocolNuqql); got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+}
+
+func TestNewSettingMessage(t *testing.T) {
+	for _, test := range []struct {
+		d    *settingData
+		want string
+	}{
+		{&settingData{1, "filter_own", "true", false},
+			"info: account 1 setting filter_own: true\r\n"},
+		{&settingData{1, "proxy", "", true},
+			"info: account 1 setting proxy:  (default)\r\n"},
+	} {
+		got := newSettingMessage(test.d).format(protocolNuqql)
+		if got != test.want {
+			t.Errorf("got %q, wanted %q", got, test.want)
+		}
+	}
+}
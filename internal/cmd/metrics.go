@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+var (
+	// idRegex is a regular expression for mattermost ids in api paths
+	idRegex = regexp.MustCompile("^[a-z0-9]{26}$")
+
+	// apiRoutes are the routes of the mattermost api calls of the
+	// clients; ":id" matches an id or "me" and ":name" matches any path
+	// element, e.g., a user name, email address or channel name
+	apiRoutes = []string{
+		"POST /users/login",
+		"GET /users/:id",
+		"GET /users/:id/status",
+		"PUT /users/:id/status",
+		"GET /users/:id/teams",
+		"GET /users/:id/teams/:id/channels",
+		"GET /users/:id/teams/:id/channels/members",
+		"GET /users/username/:name",
+		"GET /users/email/:name",
+		"POST /users/ids",
+		"POST /users/status/ids",
+		"GET /teams/:id",
+		"GET /teams/name/:name",
+		"GET /teams/:id/channels",
+		"GET /teams/:id/channels/name/:name",
+		"POST /channels",
+		"POST /channels/direct",
+		"GET /channels/:id",
+		"DELETE /channels/:id",
+		"PUT /channels/:id/patch",
+		"GET /channels/:id/posts",
+		"GET /channels/:id/members",
+		"POST /channels/:id/members",
+		"DELETE /channels/:id/members/:id",
+		"PUT /channels/:id/members/:id/roles",
+		"POST /channels/members/:id/view",
+		"POST /posts",
+		"GET /files/:id/link",
+	}
+
+	// apiRouteOther is the route of api calls that match no api route
+	apiRouteOther = "other"
+
+	// metrics contains all metrics of the daemon
+	metrics = newMetrics()
+)
+
+// metric is a metric in the prometheus text format with values for each
+// sample name suffix and set of labels, e.g., `_sum{endpoint="other"}`
+type metric struct {
+	name   string
+	help   string
+	typ    string
+	values map[string]float64
+}
+
+// write writes the metric in the prometheus text format to w
+func (m *metric) write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name,
+		m.help, m.name, m.typ); err != nil {
+		return err
+	}
+	labels := make([]string, 0, len(m.values))
+	for l := range m.values {
+		labels = append(labels, l)
+	}
+	slices.Sort(labels)
+	for _, l := range labels {
+		v := strconv.FormatFloat(m.values[l], 'g', -1, 64)
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", m.name, l,
+			v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatLabels formats the label names and values in kv as prometheus
+// labels, e.g., `{account="1"}`
+func formatLabels(kv ...string) string {
+	if len(kv) == 0 {
+		return ""
+	}
+	var labels []string
+	for i := 0; i+1 < len(kv); i += 2 {
+		labels = append(labels, fmt.Sprintf("%s=%q", kv[i], kv[i+1]))
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+// daemonMetrics contains the metrics of the daemon
+type daemonMetrics struct {
+	mutex sync.Mutex
+
+	messagesReceived *metric
+	messagesSent     *metric
+	reconnects       *metric
+	apiCalls         *metric
+	apiErrors        *metric
+	apiDuration      *metric
+	queueLength      *metric
+	clients          *metric
+}
+
+// add adds v to the metric m with the labels kv
+func (d *daemonMetrics) add(m *metric, v float64, kv ...string) {
+	d.addSample(m, "", v, kv...)
+}
+
+// addSample adds v to the sample of the metric m with the name suffix, e.g.,
+// "_sum", and the labels kv
+func (d *daemonMetrics) addSample(m *metric, suffix string, v float64,
+	kv ...string) {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	m.values[suffix+formatLabels(kv...)] += v
+}
+
+// set sets the metric m with the labels kv to v
+func (d *daemonMetrics) set(m *metric, v float64, kv ...string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	m.values[formatLabels(kv...)] = v
+}
+
+// observeAPICall records an api call to endpoint that took duration d and
+// failed if failed is set
+func (d *daemonMetrics) observeAPICall(endpoint string, duration time.Duration,
+	failed bool) {
+
+	d.add(d.apiCalls, 1, "endpoint", endpoint)
+	if failed {
+		d.add(d.apiErrors, 1, "endpoint", endpoint)
+	}
+	d.addSample(d.apiDuration, "_sum", duration.Seconds(), "endpoint",
+		endpoint)
+	d.addSample(d.apiDuration, "_count", 1, "endpoint", endpoint)
+}
+
+// getAccountsOnline returns the account online metric of all accounts
+func getAccountsOnline() *metric {
+	m := newMetric("nuqql_account_online", "gauge",
+		"Online state of the account (1 online, 0 offline).")
+	for _, a := range getAccounts() {
+		online := 0.0
+		if a.client != nil && a.client.isOnline() {
+			online = 1
+		}
+		m.values[formatLabels("account", strconv.Itoa(a.ID))] = online
+	}
+	return m
+}
+
+// write writes all metrics in the prometheus text format to w
+func (d *daemonMetrics) write(w io.Writer) error {
+	// get account online states before locking metrics
+	online := getAccountsOnline()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, m := range []*metric{
+		d.messagesReceived,
+		d.messagesSent,
+		d.reconnects,
+		d.apiCalls,
+		d.apiErrors,
+		d.apiDuration,
+		d.queueLength,
+		d.clients,
+		online,
+	} {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newMetric creates a new metric
+func newMetric(name, typ, help string) *metric {
+	return &metric{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		values: make(map[string]float64),
+	}
+}
+
+// newMetrics creates the metrics of the daemon
+func newMetrics() *daemonMetrics {
+	d := &daemonMetrics{
+		messagesReceived: newMetric("nuqql_messages_received_total",
+			"counter", "Number of received messages."),
+		messagesSent: newMetric("nuqql_messages_sent_total",
+			"counter", "Number of sent messages."),
+		reconnects: newMetric("nuqql_websocket_reconnects_total",
+			"counter", "Number of websocket reconnects."),
+		apiCalls: newMetric("nuqql_api_calls_total",
+			"counter", "Number of mattermost api calls."),
+		apiErrors: newMetric("nuqql_api_errors_total",
+			"counter", "Number of failed mattermost api calls."),
+		apiDuration: newMetric("nuqql_api_call_duration_seconds",
+			"summary", "Duration of mattermost api calls."),
+		queueLength: newMetric("nuqql_client_queue_length",
+			"gauge", "Number of messages in the client queue."),
+		clients: newMetric("nuqql_connected_clients",
+			"gauge", "Number of connected clients."),
+	}
+	d.queueLength.values[""] = 0
+	d.clients.values[""] = 0
+	return d
+}
+
+// matchAPIRoute checks if the method and path elements parts match the api
+// route
+func matchAPIRoute(route, method string, parts []string) bool {
+	routeMethod, routePath, _ := strings.Cut(route, " ")
+	routeParts := strings.Split(routePath, "/")
+	if routeMethod != method || len(routeParts) != len(parts) {
+		return false
+	}
+	for i, p := range routeParts {
+		switch p {
+		case ":id":
+			if parts[i] != "me" && !idRegex.MatchString(parts[i]) {
+				return false
+			}
+		case ":name":
+			if parts[i] == "" {
+				return false
+			}
+		default:
+			if parts[i] != p {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// getAPIEndpoint returns the api route of the request r, e.g.,
+// "GET /users/:id/status", or "other" if it matches no known api route; the
+// routes limit the number of endpoint labels of the metrics
+func getAPIEndpoint(r *http.Request) string {
+	path := r.URL.Path
+	if i := strings.Index(path, model.APIURLSuffix); i != -1 {
+		path = path[i+len(model.APIURLSuffix):]
+	}
+	parts := strings.Split(path, "/")
+	for _, route := range apiRoutes {
+		if matchAPIRoute(route, r.Method, parts) {
+			return route
+		}
+	}
+	return apiRouteOther
+}
+
+// metricsTransport is a http transport that records metrics of api calls
+type metricsTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip runs the http request r and records its metrics
+func (t *metricsTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(r)
+	failed := err != nil || resp.StatusCode >= http.StatusBadRequest
+	metrics.observeAPICall(getAPIEndpoint(r), time.Since(start), failed)
+	return resp, err
+}
+
+// accountHealth contains the connection health of an account
+type accountHealth struct {
+	ID        int    `json:"id"`
+	User      string `json:"user"`
+	Online    bool   `json:"online"`
+	Since     int64  `json:"since,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// handleHealthz handles a request for the health of all accounts; if an
+// account is offline, the status code is 503
+func handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	status := http.StatusOK
+	health := []*accountHealth{}
+	for _, a := range getAccounts() {
+		if a.client == nil {
+			continue
+		}
+		h := &accountHealth{ID: a.ID, User: a.User}
+		h.Online, h.Since, h.LastError = a.client.getHealth()
+		if !h.Online {
+			status = http.StatusServiceUnavailable
+		}
+		health = append(health, h)
+	}
+	writeJSON(w, status, health)
+}
+
+// handleMetrics handles a request for the metrics
+func handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := metrics.write(w); err != nil {
+		logError(err)
+	}
+}
+
+// newMetricsHandler creates the http handler of the metrics server; if an
+// auth secret is configured, requests must contain it as bearer token
+func newMetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", handleMetrics)
+	mux.HandleFunc("GET /healthz", handleHealthz)
+	if conf.AuthSecret != "" {
+		return requireAuth(conf.AuthSecret, mux)
+	}
+	return mux
+}
+
+// runMetricsServer runs the metrics server in the background if it is
+// enabled
+func runMetricsServer() {
+	if conf.MetricsAddress == "" {
+		return
+	}
+	startHTTPServer("Metrics", conf.MetricsAddress, newMetricsHandler())
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFormatLabels(t *testing.T) {
+	want := `{account="1",endpoint="GET /users"}`
+	got := formatLabels("account", "1", "endpoint", "GET /users")
+	if got != want {
+		t.Errorf("got %s, wanted %s", got, want)
+	}
+	if got := formatLabels(); got != "" {
+		t.Errorf("got %s, wanted empty labels", got)
+	}
+}
+
+func TestMetricWrite(t *testing.T) {
+	m := newMetric("test_total", "counter", "Test metric.")
+	m.values[formatLabels("account", "2")] = 3
+	m.values[formatLabels("account", "1")] = 1.5
+	want := "# HELP test_total Test metric.\n" +
+		"# TYPE test_total counter\n" +
+		"test_total{account=\"1\"} 1.5\n" +
+		"test_total{account=\"2\"} 3\n"
+	var b strings.Builder
+	if err := m.write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+}
+
+func TestGetAPIEndpoint(t *testing.T) {
+	for path, want := range map[string]string{
+		"/api/v4/users/me": "GET /users/:id",
+		"/api/v4/users/abcdefghijklmnopqrstuvwxyz/status": "GET " +
+			"/users/:id/status",
+		"/prefix/api/v4/channels/abcdefghijklmnopqrstuvwxyz": "GET " +
+			"/channels/:id",
+		"/api/v4/users/username/alice": "GET /users/username/:name",
+		"/api/v4/users/email/alice@example.com": "GET " +
+			"/users/email/:name",
+		"/api/v4/teams/abcdefghijklmnopqrstuvwxyz/channels/name/" +
+			"y": "GET /teams/:id/channels/name/:name",
+		"/api/v4/users/alice": "other",
+		"/api/v4/unknown":     "other",
+	} {
+		r := httptest.NewRequest("GET", path, nil)
+		if got := getAPIEndpoint(r); got != want {
+			t.Errorf("got %s, wanted %s", got, want)
+		}
+	}
+}
+
+func TestMetricsTransport(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+	defer s.Close()
+
+	c := &http.Client{Transport: &metricsTransport{
+		base: http.DefaultTransport,
+	}}
+	resp, err := c.Get(s.URL + "/api/v4/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	var b strings.Builder
+	if err := metrics.write(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`nuqql_api_calls_total{endpoint="other"} 1`,
+		`nuqql_api_errors_total{endpoint="other"} 1`,
+		"# TYPE nuqql_api_call_duration_seconds summary\n",
+		`nuqql_api_call_duration_seconds_count{endpoint="other"} 1`,
+		`nuqql_api_call_duration_seconds_sum{endpoint="other"} `,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("got %q, wanted %s", b.String(), want)
+		}
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	accounts = make(map[int]*account)
+	defer func() {
+		// cleanup
+		accounts = make(map[int]*account)
+	}()
+	accounts[1] = &account{ID: 1, Protocol: "mattermost",
+		User: "user@server", client: &mattermost{}}
+
+	h := newMetricsHandler()
+	for _, test := range []struct {
+		path   string
+		status int
+		want   string
+	}{
+		{"/metrics", http.StatusOK, `nuqql_account_online{account="1"} 0`},
+		{"/healthz", http.StatusServiceUnavailable, `"online":false`},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.status ||
+			!strings.Contains(w.Body.String(), test.want) {
+			t.Errorf("%s: got %d %q, wanted %d %q", test.path,
+				w.Code, w.Body.String(), test.status, test.want)
+		}
+	}
+}
+
+func TestMetricsHandlerAuth(t *testing.T) {
+	defer func() {
+		// cleanup
+		conf.AuthSecret = ""
+	}()
+	conf.AuthSecret = "secret"
+	h := newMetricsHandler()
+
+	for _, test := range []struct {
+		path, auth string
+		status     int
+	}{
+		{"/metrics", "", http.StatusUnauthorized},
+		{"/healthz", "Bearer wrong", http.StatusUnauthorized},
+		{"/metrics", "Bearer secret", http.StatusOK},
+		{"/healthz", "Bearer secret", http.StatusOK},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		if test.auth != "" {
+			r.Header.Set("Authorization", test.auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s %q: got %d, wanted %d", test.path,
+				test.auth, w.Code, test.status)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+)
+
+// checkPeer checks if the peer of the unix socket connection conn runs as
+// an allowed user; if peer credentials are not supported, only the socket
+// permissions restrict access
+func checkPeer(conn net.Conn) error {
+	uid, err := getPeerUID(conn)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(conf.GetAllowedUIDs(), uid) {
+		return fmt.Errorf("user id %d is not allowed", uid)
+	}
+	return nil
+}
+
+// setSocketPermissions sets the group and permissions of the unix socket
+// file, so only the allowed users can connect to it
+func setSocketPermissions(file string) error {
+	gid, err := conf.GetSocketGroup()
+	if err != nil {
+		return err
+	}
+	if gid != -1 {
+		if err := os.Chown(file, -1, gid); err != nil {
+			return err
+		}
+	}
+	return os.Chmod(file, conf.GetSocketMode())
+}
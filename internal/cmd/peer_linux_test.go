@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestCheckPeer(t *testing.T) {
+	uids := conf.AllowedUIDs
+	defer func() {
+		// cleanup
+		conf.AllowedUIDs = uids
+	}()
+
+	// create unix socket connection
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "test.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	client, err := net.Dial("unix", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// test own user, allowed by default
+	conf.AllowedUIDs = nil
+	if err := checkPeer(conn); err != nil {
+		t.Errorf("got %v, wanted nil", err)
+	}
+
+	// test other user
+	conf.AllowedUIDs = []uint32{uint32(os.Getuid()) + 1}
+	if err := checkPeer(conn); err == nil {
+		t.Errorf("got nil, wanted error")
+	}
+
+	// test tcp connection
+	p1, p2 := net.Pipe()
+	defer func() { _ = p1.Close() }()
+	defer func() { _ = p2.Close() }()
+	if err := checkPeer(p1); err == nil {
+		t.Errorf("got nil, wanted error")
+	}
+}
+
+// dialAs connects to the unix socket file as the user uid in the group gid;
+// it changes the credentials of the current thread, so it must be called
+// from a goroutine that is locked to its thread and never unlocked
+func dialAs(uid, gid int, file string) (net.Conn, error) {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_SETGROUPS, 0, 0,
+		0); errno != 0 {
+		return nil, errno
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_SETRESGID,
+		uintptr(gid), uintptr(gid), uintptr(gid)); errno != 0 {
+		return nil, errno
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_SETRESUID,
+		uintptr(uid), uintptr(uid), uintptr(uid)); errno != 0 {
+		return nil, errno
+	}
+	return net.Dial("unix", file)
+}
+
+func TestSetSocketPermissions(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("connecting as other users requires root")
+	}
+	uids, group := conf.AllowedUIDs, conf.SocketGroup
+	defer func() {
+		// cleanup
+		conf.AllowedUIDs = uids
+		conf.SocketGroup = group
+	}()
+
+	// allow a second user in the socket group
+	const other = 65534
+	conf.AllowedUIDs = []uint32{0, other}
+	conf.SocketGroup = strconv.Itoa(other)
+
+	// create unix socket in a directory the other user can access
+	dir, err := os.MkdirTemp("", "nuqql-mattermostd-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "test.sock")
+	l, err := listen("unix", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	if err := setSocketPermissions(file); err != nil {
+		t.Fatal(err)
+	}
+
+	// dial connects to the socket as the user uid in the group gid
+	dial := func(uid, gid int) (net.Conn, error) {
+		type result struct {
+			conn net.Conn
+			err  error
+		}
+		results := make(chan result)
+		go func() {
+			runtime.LockOSThread()
+			conn, err := dialAs(uid, gid, file)
+			results <- result{conn, err}
+		}()
+		r := <-results
+		return r.conn, r.err
+	}
+
+	// test allowed user in socket group
+	client, err := dial(other, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	if err := checkPeer(conn); err != nil {
+		t.Errorf("got %v, wanted nil", err)
+	}
+
+	// test user not in socket group
+	if client, err := dial(other-1, other-1); err == nil {
+		_ = client.Close()
+		t.Errorf("got nil, wanted error")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// getPeerUID returns the user id of the peer of the unix socket connection
+// conn; peer credentials are only supported on linux
+func getPeerUID(_ net.Conn) (uint32, error) {
+	return 0, fmt.Errorf("peer credentials: %w", errors.ErrUnsupported)
+}
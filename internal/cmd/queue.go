@@ -11,17 +11,19 @@ var (
 
 // queue stores messages for the client
 type queue struct {
-	queue    []string
-	client   net.Conn
-	clients  chan net.Conn
-	messages chan string
+	queue     []*message
+	client    net.Conn
+	clients   chan net.Conn
+	messages  chan *message
+	protocol  string
+	protocols chan string
 }
 
 // sendToClient sends the contents of the message queue to the client
 func (q *queue) sendToClient() {
 	w := bufio.NewWriter(q.client)
 	for len(q.queue) > 0 {
-		msg := q.queue[0]
+		msg := q.queue[0].format(q.protocol)
 		n, err := w.WriteString(msg)
 		if n < len(msg) || err != nil {
 			if err := q.client.Close(); err != nil {
@@ -53,6 +55,10 @@ func (q *queue) run() {
 				q.clients = nil
 			}
 			q.client = c
+			if q.client == nil {
+				// reset protocol for the next client
+				q.protocol = protocolNuqql
+			}
 
 			if q.client != nil {
 				// new client, send all queued messages to
@@ -60,6 +66,11 @@ func (q *queue) run() {
 				q.sendToClient()
 			}
 
+		case p := <-q.protocols:
+			// handle protocol change of the client
+			q.protocol = p
+			continue
+
 		case m, more := <-q.messages:
 			// handle message for client
 			if !more {
@@ -76,6 +87,8 @@ func (q *queue) run() {
 			q.sendToClient()
 		}
 
+		metrics.set(metrics.queueLength, float64(len(q.queue)))
+
 		// all channels closed, stop here
 		if q.clients == nil && q.messages == nil {
 			return
@@ -84,10 +97,16 @@ func (q *queue) run() {
 }
 
 // send sends msg to the (future) client via the queue
-func (q *queue) send(msg string) {
+func (q *queue) send(msg *message) {
 	q.messages <- msg
 }
 
+// setProtocol sets the protocol of the client; messages that are still in
+// the queue are sent in the new protocol
+func (q *queue) setProtocol(protocol string) {
+	q.protocols <- protocol
+}
+
 // setClient sets conn as the client
 func (q *queue) setClient(conn net.Conn) {
 	q.clients <- conn
@@ -96,8 +115,10 @@ func (q *queue) setClient(conn net.Conn) {
 // newQueue creates a new queue
 func newQueue() *queue {
 	q := queue{
-		clients:  make(chan net.Conn),
-		messages: make(chan string),
+		clients:   make(chan net.Conn),
+		messages:  make(chan *message),
+		protocol:  protocolNuqql,
+		protocols: make(chan string),
 	}
 	go q.run()
 	return &q
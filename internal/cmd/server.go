@@ -3,66 +3,41 @@ package cmd
 import (
 	"bufio"
 	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
 	"net"
-	"net/url"
 	"os"
 	"regexp"
-	"strconv"
 	"strings"
-)
+	"sync"
+	"time"
 
-const (
-	helpMessage = `info: List of commands and their description:
-account list
-    list all accounts and their account ids.
-account add <protocol> <user> <password>
-    add a new account for chat protocol <protocol> with user name <user> and
-    the password <password>. The supported chat protocol(s) are backend
-    specific. The user name is chat protocol specific. An account id is
-    assigned to the account that can be shown with "account list".
-account <id> delete
-    delete the account with the account id <id>.
-account <id> buddies [online]
-    list all buddies on the account with the account id <id>. Optionally, show
-    only online buddies with the extra parameter "online".
-account <id> collect
-    collect all messages received on the account with the account id <id>.
-account <id> send <user> <msg>
-    send a message to the user <user> on the account with the account id <id>.
-account <id> status get
-    get the status of the account with the account id <id>.
-account <id> status set <status>
-    set the status of the account with the account id <id> to <status>.
-account <id> chat list
-    list all group chats on the account with the account id <id>.
-account <id> chat join <chat>
-    join the group chat <chat> on the account with the account id <id>.
-account <id> chat part <chat>
-    leave the group chat <chat> on the account with the account id <id>.
-account <id> chat send <chat> <msg>
-    send the message <msg> to the group chat <chat> on the account with the
-    account id <id>.
-account <id> chat users <chat>
-    list the users in the group chat <chat> on the account with the
-    account id <id>.
-account <id> chat invite <chat> <user>
-    invite the user <user> to the group chat <chat> on the account with the
-    account id <id>.
-version
-    get version of the backend
-bye
-    disconnect from backend
-quit
-    quit backend
-help
-    show this help` + "\r\n"
+	"github.com/mattermost/mattermost/server/public/model"
 )
 
 var (
 	// brRegex is a regular expression for <br/> tags
 	brRegex = regexp.MustCompile("(?i)<br/>")
+
+	// errAuthRequired is returned if a client sends a command before it
+	// authenticated with the auth command
+	errAuthRequired = errors.New("authentication required, enter " +
+		"\"auth <secret>\"")
+
+	// errAuthFailed is returned if a client sent a wrong secret
+	errAuthFailed = errors.New("authentication failed")
+
+	// clientMutex allows only one client connection at the same time on
+	// all listeners
+	clientMutex sync.Mutex
+
+	// authTimeout is the time a new client has for the TLS handshake and
+	// the authentication
+	authTimeout = 30 * time.Second
 )
 
 // server stores server information
@@ -72,351 +47,798 @@ type server struct {
 	listener net.Listener
 	conn     net.Conn
 
+	// useTLS enables TLS on the listener
+	useTLS bool
+
+	// authSecret is the shared secret clients must authenticate with;
+	// empty disables authentication
+	authSecret string
+
+	// initProtocol is the initial protocol of clients
+	initProtocol string
+
 	// is server/client active?
 	serverActive bool
 	clientActive bool
+
+	// commands tracks the running commands of the client
+	commands sync.WaitGroup
+
+	// lastOrdered is closed when the last ordered command of the client
+	// is done
+	lastOrdered chan struct{}
+
+	// protocol is the protocol of the client, see protocolNuqql and
+	// protocolJSON
+	protocol string
+}
+
+// jsonCommand is a client command in the json protocol
+type jsonCommand struct {
+	// Tag is the optional tag of the command
+	Tag string `json:"tag"`
+
+	// Command contains the words and arguments of the command, e.g.,
+	// ["account", "0", "chat", "send", "my chat", "hello"]
+	Command []string `json:"command"`
 }
 
-// sendClient sends msg to the client
-func (s *server) sendClient(msg string) {
+// commandTagKey is the context key of the tag of a client command
+type commandTagKey struct{}
+
+// withCommandTag returns a copy of ctx that contains the command tag
+func withCommandTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, commandTagKey{}, tag)
+}
+
+// getCommandTag returns the command tag in ctx or an empty string
+func getCommandTag(ctx context.Context) string {
+	tag, _ := ctx.Value(commandTagKey{}).(string)
+	return tag
+}
+
+// protocolKey is the context key of the client protocol of a command
+type protocolKey struct{}
+
+// withProtocol returns a copy of ctx that contains the client protocol
+func withProtocol(ctx context.Context, protocol string) context.Context {
+	return context.WithValue(ctx, protocolKey{}, protocol)
+}
+
+// getProtocol returns the client protocol in ctx; defaults to the nuqql
+// protocol
+func getProtocol(ctx context.Context) string {
+	if protocol, ok := ctx.Value(protocolKey{}).(string); ok {
+		return protocol
+	}
+	return protocolNuqql
+}
+
+// splitCommandTag splits the optional tag "#<tag>" from the command cmd
+func splitCommandTag(cmd string) (tag, rest string) {
+	if !strings.HasPrefix(cmd, "#") {
+		return "", cmd
+	}
+	tag, rest, _ = strings.Cut(cmd[1:], " ")
+	return
+}
+
+// tagMessage prefixes each line in msg with the command tag
+func tagMessage(tag, msg string) string {
+	lines := strings.SplitAfter(msg, "\r\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "#" + tag + " " + line
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// sendClient sends msg to the client; if the command in ctx has a tag, msg
+// is tagged with the tag
+func (s *server) sendClient(ctx context.Context, msg *message) {
+	if tag := getCommandTag(ctx); tag != "" {
+		msg = msg.withTag(tag)
+	}
 	clientQueue.send(msg)
 }
 
+// sendInfo sends an info message with format and args to the client
+func (s *server) sendInfo(ctx context.Context, format string, args ...any) {
+	s.sendClient(ctx, newInfoMessage(fmt.Sprintf(format, args...)))
+}
+
+// sendError sends an error message containing err to the client
+func (s *server) sendError(ctx context.Context, err error) {
+	s.sendClient(ctx, newErrorMessage(err))
+}
+
 // createAccountMessage creates an account message for account a
-func createAccountMessage(a *account) string {
+func createAccountMessage(a *account) *message {
 	// get account status
 	status := "offline"
 	if a.client != nil && a.client.isOnline() {
 		status = "online"
 	}
+	if a.Disabled {
+		status = "disabled"
+	}
 
-	// return message with the following format:
-	// account: <id> <name> <protocol> <user> <status>
-	return fmt.Sprintf("account: %d %s %s %s %s\r\n", a.ID, "()",
-		a.Protocol, a.User, status)
+	return newAccountMessage(&accountData{
+		ID:       a.ID,
+		Name:     a.getName(),
+		Protocol: a.Protocol,
+		User:     a.User,
+		Status:   status,
+	})
 }
 
-// getAccountListMessages returns the account list as a string of messages
-func (s *server) getAccountListMessages() (messages string) {
+// getAccountListMessages returns the account list as messages
+func (s *server) getAccountListMessages() (messages []*message) {
 	accounts := getAccounts()
 	for _, a := range accounts {
-		messages += createAccountMessage(a)
+		messages = append(messages, createAccountMessage(a))
 	}
-	messages += "info: listed accounts.\r\n"
+	messages = append(messages, newInfoMessage("listed accounts."))
 	if len(accounts) == 0 {
-		h := "info: You do not have any accounts configured.\r\n"
-		h += "info: You can add a new mattermost account with the " +
-			"following command: " +
-			"account add mattermost <username>@<server> " +
-			"<password>\r\n"
-		h += "info: Example: account add mattermost " +
-			"dummy@yourserver.org:8065 YourPassword\r\n"
-		messages += h
+		messages = append(messages,
+			newInfoMessage("You do not have any accounts "+
+				"configured."),
+			newInfoMessage("You can add a new mattermost "+
+				"account with the following command: "+
+				"account add mattermost "+
+				"<username>@<server> <password>"),
+			newInfoMessage("Example: account add mattermost "+
+				"dummy@yourserver.org:8065 YourPassword"))
 	}
 	return
 }
 
 // handleAccountList handles an account list command
-func (s *server) handleAccountList() {
+func (s *server) handleAccountList(ctx context.Context, _ *account, _ []string) {
 	// send messages as replies
-	r := s.getAccountListMessages()
-	logDebug(r)
-	s.sendClient(r)
+	for _, m := range s.getAccountListMessages() {
+		s.sendClient(ctx, m)
+	}
+}
+
+// accountContext returns the context of accounts started by the command
+// with the context ctx; the account outlives the command, so it does not
+// get the command's deadline and cancellation
+func accountContext(ctx context.Context) context.Context {
+	return context.WithoutCancel(ctx)
 }
 
 // handleAccountAdd handles an account add command
-func (s *server) handleAccountAdd(ctx context.Context, parts []string) {
-	// expected command format:
-	// account add <protocol> <user> <password>
-	if len(parts) < 5 {
+func (s *server) handleAccountAdd(ctx context.Context, _ *account, args []string) {
+	// account add <protocol> <user> <password> [name]
+	protocol := args[0]
+	user := args[1]
+	password := args[2]
+	name := args[3]
+
+	id, err := addAccount(accountContext(ctx), protocol, user,
+		password, name)
+	if err != nil {
+		s.sendError(ctx, err)
 		return
 	}
-	protocol := parts[2]
-	user := parts[3]
-	password := parts[4]
-	id := addAccount(ctx, protocol, user, password)
 	logInfo("added new account with id:", id)
 
 	// optional reply:
 	// info: new account added.
-	s.sendClient(fmt.Sprintf("info: added account %d.\r\n", id))
+	s.sendInfo(ctx, "added account %d.", id)
 	if conf.PushAccounts {
 		// send account message with push accounts enabled
 		a := getAccount(id)
 		m := createAccountMessage(a)
-		s.sendClient(m)
+		s.sendClient(ctx, m)
 	}
 }
 
 // handleAccountDelete handles an account delete command
-func (s *server) handleAccountDelete(id int) {
-	if delAccount(id) {
-		logInfo("deleted account with id: ", id)
-		s.sendClient(fmt.Sprintf("info: account %d deleted.\r\n", id))
+func (s *server) handleAccountDelete(ctx context.Context, a *account, _ []string) {
+	// account <id> delete
+	if !delAccount(a.ID) {
+		s.sendError(ctx, fmt.Errorf("unknown account %d", a.ID))
+		return
+	}
+	logInfo("deleted account with id: ", a.ID)
+	s.sendInfo(ctx, "account %d deleted.", a.ID)
+}
+
+// sendAccountUpdate sends the info message with format and args and, if push
+// accounts is enabled, the account message of the account with id to the
+// client
+func (s *server) sendAccountUpdate(ctx context.Context, id int, format string, args ...any) {
+	s.sendInfo(ctx, format, args...)
+	if a := getAccount(id); a != nil && conf.PushAccounts {
+		s.sendClient(ctx, createAccountMessage(a))
 	}
+}
+
+// handleAccountEdit handles an account edit command
+func (s *server) handleAccountEdit(ctx context.Context, a *account, args []string) {
+	// account <id> edit <field> <value>
+	field, value := args[0], args[1]
 
+	err := editAccount(accountContext(ctx), a.ID, field, value)
+	if err != nil {
+		s.sendError(ctx, err)
+		return
+	}
+	logInfo("edited", field, "of account", a.ID)
+	s.sendAccountUpdate(ctx, a.ID, "edited %s of account %d.", field, a.ID)
+}
+
+// handleAccountEnable handles an account enable command
+func (s *server) handleAccountEnable(ctx context.Context, a *account, _ []string) {
+	// account <id> enable
+	err := setAccountDisabled(accountContext(ctx), a.ID, false)
+	if err != nil {
+		s.sendError(ctx, err)
+		return
+	}
+	logInfo("enabled account", a.ID)
+	s.sendAccountUpdate(ctx, a.ID, "enabled account %d.", a.ID)
+}
+
+// handleAccountDisable handles an account disable command
+func (s *server) handleAccountDisable(ctx context.Context, a *account, _ []string) {
+	// account <id> disable
+	err := setAccountDisabled(accountContext(ctx), a.ID, true)
+	if err != nil {
+		s.sendError(ctx, err)
+		return
+	}
+	logInfo("disabled account", a.ID)
+	s.sendAccountUpdate(ctx, a.ID, "disabled account %d.", a.ID)
+}
+
+// handleAccountReconnect handles an account reconnect command
+func (s *server) handleAccountReconnect(ctx context.Context, a *account, _ []string) {
+	// account <id> reconnect
+	if err := reconnectAccount(accountContext(ctx), a.ID); err != nil {
+		s.sendError(ctx, err)
+		return
+	}
+	logInfo("reconnecting account", a.ID)
+	s.sendInfo(ctx, "reconnecting account %d.", a.ID)
+}
+
+// handleAccountGet handles an account get command
+func (s *server) handleAccountGet(ctx context.Context, a *account, args []string) {
+	// account <id> get [key]
+	settings := accountSettingList
+	if args[0] != "" {
+		setting, err := getAccountSetting(args[0])
+		if err != nil {
+			s.sendError(ctx, err)
+			return
+		}
+		settings = []*accountSetting{setting}
+	}
+	for _, setting := range settings {
+		value, isDefault := a.getSettingValue(setting)
+		s.sendClient(ctx, newSettingMessage(&settingData{
+			Account: a.ID,
+			Key:     setting.key,
+			Value:   value,
+			Default: isDefault,
+		}))
+	}
+}
+
+// handleAccountSet handles an account set command
+func (s *server) handleAccountSet(ctx context.Context, a *account, args []string) {
+	// account <id> set <key> <value>
+	key, value := args[0], args[1]
+
+	err := setAccountSetting(accountContext(ctx), a.ID, key, value)
+	if err != nil {
+		s.sendError(ctx, err)
+		return
+	}
+	logInfo("set setting", key, "of account", a.ID)
+	s.sendInfo(ctx, "set %s of account %d.", key, a.ID)
 }
 
 // handleAccountBuddies handles an account buddies command
-func (s *server) handleAccountBuddies(a *account) {
-	for _, b := range a.client.getBuddies() {
-		//buddy: <acc_id> status: <status> name: <name> alias: [alias]
-		m := fmt.Sprintf("buddy: %d status: %s name: %s alias: %s\r\n",
-			a.ID, b.status, b.user, url.PathEscape(b.name))
-		s.sendClient(m)
+func (s *server) handleAccountBuddies(ctx context.Context, a *account, args []string) {
+	// account <id> buddies [online]
+	var buddies []*buddy
+	var err error
+	switch args[0] {
+	case "":
+		buddies, err = a.client.getBuddies()
+	case "online":
+		buddies, err = a.client.getOnlineBuddies(ctx)
+	default:
+		err = fmt.Errorf("unknown filter %s, expected online", args[0])
+	}
+	if err != nil {
+		s.sendError(ctx, err)
+		return
+	}
+	for _, b := range buddies {
+		s.sendClient(ctx, newBuddyMessage(&buddyData{
+			Account: a.ID,
+			Status:  b.status,
+			Name:    b.user,
+			Alias:   b.name,
+		}))
 	}
+	s.sendInfo(ctx, "listed buddies.")
 }
 
 // handleAccountCollect handles an account collect command
-func (s *server) handleAccountCollect(a *account) {
-	a.client.getHistory()
+func (s *server) handleAccountCollect(ctx context.Context, a *account, _ []string) {
+	// account <id> collect
+	history, err := a.client.getHistory()
+	if err != nil {
+		s.sendError(ctx, err)
+		return
+	}
+	for _, msg := range history {
+		s.sendClient(ctx, msg)
+	}
+	s.sendInfo(ctx, "collected messages.")
 }
 
 // unescapeMessage converts nuqql message to original format:
-// nuqql sends html-escaped messages with newlines replaced by <br/>
-func unescapeMessage(msg string) string {
+// nuqql sends html-escaped messages with newlines replaced by <br/>;
+// messages in the json protocol are not escaped
+func unescapeMessage(ctx context.Context, msg string) string {
+	if getProtocol(ctx) == protocolJSON {
+		return msg
+	}
 	msg = brRegex.ReplaceAllString(msg, "\n")
 	msg = html.UnescapeString(msg)
 	return msg
 }
 
 // handleAccountSend handles an account send command
-func (s *server) handleAccountSend(ctx context.Context, a *account, parts []string) {
+func (s *server) handleAccountSend(ctx context.Context, a *account, args []string) {
 	// account <id> send <user> <msg>
-	if len(parts) < 5 {
+	s.sendMessage(ctx, a, args[0], args[1])
+}
+
+// sendMessage sends the nuqql message msg to channel on account a
+func (s *server) sendMessage(ctx context.Context, a *account, channel, msg string) {
+	logDebug("sending message to channel "+channel+":", msg)
+	if err := a.client.sendMsg(ctx, channel, unescapeMessage(ctx, msg)); err != nil {
+		s.sendError(ctx, err)
 		return
 	}
-	channel := parts[3]
-	msg := strings.Join(parts[4:], " ")
-	logDebug("sending message to channel "+channel+":", msg)
-	a.client.sendMsg(ctx, channel, unescapeMessage(msg))
+	s.sendInfo(ctx, "sent message to %s.", channel)
 }
 
 // handleAccountStatusGet handles an account status get command
-func (s *server) handleAccountStatusGet(ctx context.Context, a *account) {
+func (s *server) handleAccountStatusGet(ctx context.Context, a *account, _ []string) {
 	// account <id> status get
-	status := a.client.getStatus(ctx)
-	if status == "" {
+	status, err := a.client.getStatus(ctx)
+	if err != nil {
+		s.sendError(ctx, err)
 		return
 	}
 
-	// create and send status message with format:
-	// status: account <acc_id> status: <status>
-	m := fmt.Sprintf("status: account %d status: %s\r\n", a.ID, status)
-	s.sendClient(m)
+	s.sendClient(ctx, newStatusMessage(&statusData{
+		Account: a.ID,
+		Status:  status,
+	}))
 }
 
 // handleAccountStatusSet handles an account status set command
-func (s *server) handleAccountStatusSet(ctx context.Context, a *account, parts []string) {
+func (s *server) handleAccountStatusSet(ctx context.Context, a *account, args []string) {
 	// account <id> status set <status>
-	if len(parts) < 5 {
+	status := args[0]
+	if err := a.client.setStatus(ctx, status); err != nil {
+		s.sendError(ctx, err)
 		return
 	}
 
-	// try to set status
-	status := parts[4]
-	a.client.setStatus(ctx, status)
+	// reply with new status
+	s.handleAccountStatusGet(ctx, a, nil)
 }
 
-// handleAccountStatus handles an account status command
-func (s *server) handleAccountStatus(ctx context.Context, a *account, parts []string) {
-	// status commands have at least 4 parts
-	if len(parts) < 4 {
+// handleAccountChatList handles an account chat list command
+func (s *server) handleAccountChatList(ctx context.Context, a *account, _ []string) {
+	// account <id> chat list
+	buddies, err := a.client.getBuddies()
+	if err != nil {
+		s.sendError(ctx, err)
 		return
 	}
+	for _, b := range buddies {
+		s.sendClient(ctx, newChatListMessage(&chatListData{
+			Account: a.ID,
+			Chat:    b.user,
+			Alias:   b.name,
+			Nick:    a.client.username,
+		}))
+		u := a.client.getUnread(b.user)
+		s.sendClient(ctx, newChatUnreadMessage(&chatUnreadData{
+			Account:  a.ID,
+			Chat:     b.user,
+			Unread:   u.msgs,
+			Mentions: u.mentions,
+		}))
+	}
+	s.sendInfo(ctx, "listed chats.")
+}
 
-	// handle status commands
-	switch parts[3] {
-	case "get":
-		s.handleAccountStatusGet(ctx, a)
-	case "set":
-		s.handleAccountStatusSet(ctx, a, parts)
+// handleAccountChatBrowse handles an account chat browse command
+func (s *server) handleAccountChatBrowse(ctx context.Context, a *account, args []string) {
+	// account <id> chat browse [team]
+	team := args[0]
+	t, channels, err := a.client.browseChannels(ctx, team)
+	if err != nil {
+		s.sendError(ctx, err)
+		return
+	}
+	for _, c := range channels {
+		s.sendClient(ctx, newChatBrowseMessage(&chatBrowseData{
+			Account: a.ID,
+			Chat:    c.Id,
+			Team:    t.Name,
+			Name:    c.Name,
+			Alias:   c.DisplayName,
+		}))
 	}
+	s.sendInfo(ctx, "listed chats in team %s.", t.Name)
 }
 
-// handleAccountChatList handles an account chat list command
-func (s *server) handleAccountChatList(a *account) {
-	for _, b := range a.client.getBuddies() {
-		// chat: list: <acc_id> <chat_id> <chat_alias> <nick>
-		m := fmt.Sprintf("chat: list: %d %s %s %s\r\n",
-			a.ID, b.user, url.PathEscape(b.name),
-			a.client.username)
-		s.sendClient(m)
+// handleAccountChatCreate handles an account chat create command
+func (s *server) handleAccountChatCreate(ctx context.Context, a *account, args []string) {
+	// account <id> chat create <team>/<chat> [public|private] [display name]
+	channel := args[0]
+	typ := "private"
+	displayName := strings.TrimSpace(args[1] + " " + args[2])
+	if args[1] == "public" || args[1] == "private" {
+		typ = args[1]
+		displayName = args[2]
 	}
+	logInfo("creating channel " + channel)
+	c, err := a.client.createChannel(ctx, channel, typ, displayName)
+	if err != nil {
+		s.sendError(ctx, err)
+		return
+	}
+	s.sendInfo(ctx, "created chat %s.", c.Id)
 }
 
 // handleAccountChatJoin handles an account chat join command
-func (s *server) handleAccountChatJoin(ctx context.Context, a *account, parts []string) {
+func (s *server) handleAccountChatJoin(ctx context.Context, a *account, args []string) {
 	// account <id> chat join <chat>
-	if len(parts) < 5 {
+	channel := args[0]
+	logInfo("joining channel " + channel)
+	if err := a.client.joinChannel(ctx, channel); err != nil {
+		s.sendError(ctx, err)
 		return
 	}
-	channel := parts[4]
-	logInfo("joining channel " + channel)
-	a.client.joinChannel(ctx, channel)
+	s.sendInfo(ctx, "joined chat %s.", channel)
 }
 
 // handleAccountChatPart handles an account chat part command
-func (s *server) handleAccountChatPart(ctx context.Context, a *account, parts []string) {
+func (s *server) handleAccountChatPart(ctx context.Context, a *account, args []string) {
 	// account <id> chat part <chat>
-	if len(parts) < 5 {
+	channel := args[0]
+	logInfo("leaving channel " + channel)
+	if err := a.client.partChannel(ctx, channel); err != nil {
+		s.sendError(ctx, err)
 		return
 	}
-	channel := parts[4]
-	logInfo("leaving channel " + channel)
-	a.client.partChannel(ctx, channel)
+	s.sendInfo(ctx, "left chat %s.", channel)
 }
 
-// handleAccountChatSend handles an account chat send command
-func (s *server) handleAccountChatSend(ctx context.Context, a *account, parts []string) {
-	// account <id> chat send <chat> <msg>
-	if len(parts) < 6 {
+// handleAccountChatHeader handles account chat topic and header commands
+func (s *server) handleAccountChatHeader(ctx context.Context, a *account, args []string) {
+	// account <id> chat topic <chat> [topic]
+	// account <id> chat header <chat> [header]
+	s.handleChannelField(ctx, a, "header", args[0], args[1])
+}
+
+// handleAccountChatPurpose handles an account chat purpose command
+func (s *server) handleAccountChatPurpose(ctx context.Context, a *account, args []string) {
+	// account <id> chat purpose <chat> [purpose]
+	s.handleChannelField(ctx, a, "purpose", args[0], args[1])
+}
+
+// handleChannelField shows the header or purpose in field of channel on
+// account a or, if value is not empty, sets it to value
+func (s *server) handleChannelField(ctx context.Context, a *account, field, channel, value string) {
+	// show current value if no new value is given
+	if value == "" {
+		c, err := a.client.getChannelInfo(ctx, channel)
+		if err != nil {
+			s.sendError(ctx, err)
+			return
+		}
+		value := c.Header
+		if field == "purpose" {
+			value = c.Purpose
+		}
+
+		s.sendClient(ctx, newChatFieldMessage(&chatFieldData{
+			Account: a.ID,
+			Chat:    channel,
+			Field:   field,
+			Value:   value,
+		}))
 		return
 	}
-	channel := parts[4]
-	msg := strings.Join(parts[5:], " ")
-	logDebug("sending message to channel "+channel+":", msg)
-	a.client.sendMsg(ctx, channel, unescapeMessage(msg))
-}
 
-// handleAccountChat handles an account chat users command
-func (s *server) handleAccountChatUsers(ctx context.Context, a *account, parts []string) {
-	// account <id> chat users <chat>
-	if len(parts) < 5 {
+	// set new value
+	value = unescapeMessage(ctx, value)
+	patch := &model.ChannelPatch{Header: &value}
+	if field == "purpose" {
+		patch = &model.ChannelPatch{Purpose: &value}
+	}
+	logInfo("setting " + field + " of channel " + channel)
+	if err := a.client.patchChannel(ctx, channel, patch); err != nil {
+		s.sendError(ctx, err)
 		return
 	}
+	s.sendInfo(ctx, "set %s of chat %s.", field, channel)
+}
 
-	channel := parts[4]
-	users := a.client.getChannelUsers(ctx, channel)
-	for _, u := range users {
-		// create and send message with format:
-		// chat: user: <acc_id> <chat> <name> <alias> <state>
-		m := fmt.Sprintf("chat: user: %d %s %s %s %s\r\n",
-			a.ID, channel, u.user, url.PathEscape(u.name),
-			u.status)
-		s.sendClient(m)
+// handleAccountChatRename handles an account chat rename command
+func (s *server) handleAccountChatRename(ctx context.Context, a *account, args []string) {
+	// account <id> chat rename <chat> <display name>
+	channel := args[0]
+	displayName := args[1]
+	patch := &model.ChannelPatch{DisplayName: &displayName}
+	logInfo("renaming channel " + channel)
+	if err := a.client.patchChannel(ctx, channel, patch); err != nil {
+		s.sendError(ctx, err)
+		return
 	}
+	s.sendInfo(ctx, "renamed chat %s.", channel)
 }
 
-// handleAccountChatInvite handles an account chat invite command
-func (s *server) handleAccountChatInvite(ctx context.Context, a *account, parts []string) {
-	// account <id> chat invite <chat> <user>
-	if len(parts) < 6 {
+// handleAccountChatArchive handles an account chat archive command
+func (s *server) handleAccountChatArchive(ctx context.Context, a *account, args []string) {
+	// account <id> chat archive <chat>
+	channel := args[0]
+	logInfo("archiving channel " + channel)
+	if err := a.client.archiveChannel(ctx, channel); err != nil {
+		s.sendError(ctx, err)
 		return
 	}
+	s.sendInfo(ctx, "archived chat %s.", channel)
+}
 
-	channel := parts[4]
-	user := parts[5]
-	logInfo("adding " + user + " to channel " + channel)
-	a.client.addChannel(ctx, channel, user)
+// handleAccountChatSend handles an account chat send command
+func (s *server) handleAccountChatSend(ctx context.Context, a *account, args []string) {
+	// account <id> chat send <chat> <msg>
+	s.sendMessage(ctx, a, args[0], args[1])
 }
 
-// handleAccountChat handles an account chat command
-func (s *server) handleAccountChat(ctx context.Context, a *account, parts []string) {
-	// chat commands have at least 4 parts
-	if len(parts) < 4 {
+// handleAccountChatRead handles an account chat read command
+func (s *server) handleAccountChatRead(ctx context.Context, a *account, args []string) {
+	// account <id> chat read <chat>
+	channel := args[0]
+	if err := a.client.readChannel(ctx, channel); err != nil {
+		s.sendError(ctx, err)
 		return
 	}
+	s.sendInfo(ctx, "marked chat %s as read.", channel)
+}
 
-	// handle chat subcommands
-	switch parts[3] {
-	case "list":
-		s.handleAccountChatList(a)
-	case "join":
-		s.handleAccountChatJoin(ctx, a, parts)
-	case "part":
-		s.handleAccountChatPart(ctx, a, parts)
-	case "send":
-		s.handleAccountChatSend(ctx, a, parts)
-	case "users":
-		s.handleAccountChatUsers(ctx, a, parts)
-	case "invite":
-		s.handleAccountChatInvite(ctx, a, parts)
+// handleAccountChatUsers handles an account chat users command
+func (s *server) handleAccountChatUsers(ctx context.Context, a *account, args []string) {
+	// account <id> chat users <chat> [filter]
+	channel := args[0]
+	filter := args[1]
+	users, err := a.client.getChannelUsers(ctx, channel, filter)
+	if err != nil {
+		s.sendError(ctx, err)
+		return
+	}
+	for _, u := range users {
+		s.sendClient(ctx, newChatUserMessage(&chatUserData{
+			Account: a.ID,
+			Chat:    channel,
+			User:    u.user,
+			Alias:   u.name,
+			Status:  u.status,
+		}))
 	}
+	s.sendInfo(ctx, "listed users of chat %s.", channel)
 }
 
-// handleAccountCommand handles an account command received from the client
-func (s *server) handleAccountCommand(ctx context.Context, parts []string) {
-	// account commands consist of at least 2 parts
-	if len(parts) < 2 {
+// handleAccountChatInvite handles an account chat invite command
+func (s *server) handleAccountChatInvite(ctx context.Context, a *account, args []string) {
+	// account <id> chat invite <chat> <user>
+	channel := args[0]
+	user := args[1]
+	logInfo("adding " + user + " to channel " + channel)
+	if err := a.client.addChannel(ctx, channel, user); err != nil {
+		s.sendError(ctx, err)
 		return
 	}
+	s.sendInfo(ctx, "invited %s to chat %s.", user, channel)
+}
 
-	// commands "list" and "add" are the only ones that do not start with
-	// an account id; handle them first
-	if parts[1] == "list" {
-		s.handleAccountList()
+// handleAccountChatKick handles an account chat kick command
+func (s *server) handleAccountChatKick(ctx context.Context, a *account, args []string) {
+	// account <id> chat kick <chat> <user>
+	channel := args[0]
+	user := args[1]
+	logInfo("removing " + user + " from channel " + channel)
+	if err := a.client.kickChannel(ctx, channel, user); err != nil {
+		s.sendError(ctx, err)
 		return
 	}
-	if parts[1] == "add" {
-		s.handleAccountAdd(ctx, parts)
+	s.sendInfo(ctx, "removed %s from chat %s.", user, channel)
+}
+
+// handleAccountChatOp handles an account chat op command
+func (s *server) handleAccountChatOp(ctx context.Context, a *account, args []string) {
+	// account <id> chat op <chat> <user>
+	s.setChannelAdmin(ctx, a, args[0], args[1], true)
+}
+
+// handleAccountChatDeop handles an account chat deop command
+func (s *server) handleAccountChatDeop(ctx context.Context, a *account, args []string) {
+	// account <id> chat deop <chat> <user>
+	s.setChannelAdmin(ctx, a, args[0], args[1], false)
+}
+
+// setChannelAdmin grants or revokes the admin role of user in channel on
+// account a
+func (s *server) setChannelAdmin(ctx context.Context, a *account, channel, user string, admin bool) {
+	logInfo("updating roles of " + user + " in channel " + channel)
+	if err := a.client.setChannelAdmin(ctx, channel, user, admin); err != nil {
+		s.sendError(ctx, err)
 		return
 	}
+	s.sendInfo(ctx, "updated roles of %s in chat %s.", user, channel)
+}
+
+// handleVersion handles a version command received from the client
+func (s *server) handleVersion(ctx context.Context, _ *account, _ []string) {
+	s.sendClient(ctx, newVersionMessage(conf.Name, backendVersion))
+}
+
+// handleBye handles a bye command received from the client
+func (s *server) handleBye(_ context.Context, _ *account, _ []string) {
+	s.clientActive = false
+}
+
+// handleQuit handles a quit command received from the client
+func (s *server) handleQuit(_ context.Context, _ *account, _ []string) {
+	s.clientActive = false
+	s.serverActive = false
+}
 
-	// other commands contain at least 3 parts
-	if len(parts) < 3 {
+// handleClientProtocol handles a client protocol command received from the
+// client
+func (s *server) handleClientProtocol(ctx context.Context, _ *account, args []string) {
+	// client protocol <nuqql|json>
+	protocol := args[0]
+	if protocol != protocolNuqql && protocol != protocolJSON {
+		s.sendError(ctx, fmt.Errorf("unknown protocol %s", protocol))
 		return
 	}
+	s.protocol = protocol
+	clientQueue.setProtocol(protocol)
+	s.sendInfo(ctx, "set client protocol to %s.", protocol)
+}
 
-	// other commands contain an account id; try to parse it
-	id, err := strconv.ParseUint(parts[1], 10, 16)
+// handleAuth handles an auth command received from an authenticated client
+func (s *server) handleAuth(ctx context.Context, _ *account, _ []string) {
+	s.sendInfo(ctx, "already authenticated.")
+}
+
+// handleHelp handles a help command received from the client
+func (s *server) handleHelp(ctx context.Context, _ *account, args []string) {
+	// help [command]
+	msg, err := getHelpMessage(strings.Fields(args[0]))
 	if err != nil {
+		s.sendError(ctx, err)
 		return
 	}
+	s.sendClient(ctx, msg)
+}
 
-	// check if there is an account with this id
-	a := getAccount(int(id))
-	if a == nil {
-		return
+// parseClientCommand parses the command line received from the client in
+// the protocol of the client and returns its tag and command call; the
+// command call is nil if the command is empty
+func (s *server) parseClientCommand(line string) (string, *commandCall,
+	error) {
+
+	if s.protocol == protocolJSON {
+		// ignore empty commands
+		if line == "" {
+			return "", nil, nil
+		}
+		var cmd jsonCommand
+		if err := json.Unmarshal([]byte(line), &cmd); err != nil {
+			return "", nil, fmt.Errorf("invalid json command: %w",
+				err)
+		}
+		call, err := parseCommandParts(cmd.Command)
+		return cmd.Tag, call, err
 	}
 
-	// handle other commands
-	switch parts[2] {
-	case "delete":
-		s.handleAccountDelete(a.ID)
-	case "buddies":
-		s.handleAccountBuddies(a)
-	case "collect":
-		s.handleAccountCollect(a)
-	case "send":
-		s.handleAccountSend(ctx, a, parts)
-	case "status":
-		s.handleAccountStatus(ctx, a, parts)
-	case "chat":
-		s.handleAccountChat(ctx, a, parts)
+	// ignore empty commands
+	tag, cmd := splitCommandTag(line)
+	if cmd == "" {
+		return tag, nil, nil
 	}
+	call, err := parseCommand(cmd)
+	return tag, call, err
 }
 
-// handleVersionCommand handles a version command received from the client
-func (s *server) handleVersionCommand() {
-	versionFmt := "info: version: %s v%s\r\n"
-	msg := fmt.Sprintf(versionFmt, conf.Name, backendVersion)
-	s.sendClient(msg)
+// dispatchCommand handles the command line received from the client
+func (s *server) dispatchCommand(ctx context.Context, line string) {
+	logDebug("client:", line)
+	ctx = withProtocol(ctx, s.protocol)
+
+	// parse and run command
+	tag, call, err := s.parseClientCommand(line)
+	ctx = withCommandTag(ctx, tag)
+	if err != nil {
+		s.sendError(ctx, err)
+		return
+	}
+	if call == nil {
+		return
+	}
+	s.runCommand(ctx, call)
 }
 
-// handleCommand handles a command received from the client
-func (s *server) handleCommand(ctx context.Context, cmd string) {
-	logDebug("client:", cmd)
+// runCommand runs the command call; the command runs until it is done, its
+// timeout expires or ctx is canceled
+func (s *server) runCommand(ctx context.Context, call *commandCall) {
+
+	// some commands must be handled before reading the following
+	// commands, e.g., adding and removing accounts, so following
+	// commands see the changed accounts
+	if call.cmd.sync {
+		call.cmd.handler(s, ctx, call.account, call.args)
+		return
+	}
 
-	parts := strings.Split(cmd, " ")
-	switch parts[0] {
-	case "account":
-		s.handleAccountCommand(ctx, parts)
-	case "version":
-		s.handleVersionCommand()
-	case "bye":
-		s.clientActive = false
-	case "quit":
-		s.clientActive = false
-		s.serverActive = false
-	case "help":
-		s.sendClient(helpMessage)
+	// ordered commands, e.g., sending messages, must be handled in the
+	// order they were received from the client, so they wait for the
+	// previous ordered command
+	var prev, done chan struct{}
+	if call.cmd.ordered {
+		prev = s.lastOrdered
+		done = make(chan struct{})
+		s.lastOrdered = done
 	}
+
+	// handle other commands in the background
+	s.commands.Add(1)
+	go func() {
+		defer s.commands.Done()
+		if done != nil {
+			defer close(done)
+		}
+		if timeout := conf.GetCommandTimeout(); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		if prev != nil {
+			select {
+			case <-prev:
+			case <-ctx.Done():
+				s.sendError(ctx, ctx.Err())
+				return
+			}
+		}
+		call.cmd.handler(s, ctx, call.account, call.args)
+	}()
 }
 
 // sendEarly sends msg to client, should only be used before client queue is
 // active
-func (s *server) sendEarly(msg string) {
+func (s *server) sendEarly(m *message) {
+	msg := m.format(s.protocol)
 	w := bufio.NewWriter(s.conn)
 	n, err := w.WriteString(msg)
 	if n < len(msg) || err != nil {
@@ -429,6 +851,66 @@ func (s *server) sendEarly(msg string) {
 	}
 }
 
+// readCommand reads the next command line from the client in r
+func (s *server) readCommand(r *bufio.Reader) (string, error) {
+	c := ""
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+
+		// in the json protocol, each line is a command
+		if s.protocol == protocolJSON {
+			return strings.TrimRight(line, "\r\n"), nil
+		}
+
+		// read and concatenate cmd lines until "\r\n"
+		c += line
+		if len(c) >= 2 && c[len(c)-2] == '\r' {
+			return c[:len(c)-2], nil
+		}
+	}
+}
+
+// checkAuthSecret checks if secret is the auth secret of the server
+func (s *server) checkAuthSecret(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(secret),
+		[]byte(s.authSecret)) == 1
+}
+
+// authenticate reads commands from the client in r until the client sends
+// the auth command and returns whether the client sent the correct secret;
+// all other commands are rejected
+func (s *server) authenticate(r *bufio.Reader) bool {
+	s.sendEarly(newErrorMessage(errAuthRequired))
+	for {
+		line, err := s.readCommand(r)
+		if err != nil {
+			logError("client:", err)
+			return false
+		}
+		tag, call, err := s.parseClientCommand(line)
+		if err == nil && call == nil {
+			continue
+		}
+
+		// only accept the auth command
+		if err != nil || call.cmd.words[0] != "auth" {
+			s.sendEarly(newErrorMessage(errAuthRequired).withTag(tag))
+			continue
+		}
+		if !s.checkAuthSecret(call.args[0]) {
+			logWarn("Client authentication failed",
+				s.conn.RemoteAddr())
+			s.sendEarly(newErrorMessage(errAuthFailed).withTag(tag))
+			return false
+		}
+		s.sendEarly(newInfoMessage("authenticated.").withTag(tag))
+		return true
+	}
+}
+
 // handleClient handles a single client connection
 func (s *server) handleClient() {
 	defer func() {
@@ -437,44 +919,78 @@ func (s *server) handleClient() {
 		}
 	}()
 	logInfo("New client connection", s.conn.RemoteAddr())
+	s.protocol = s.initProtocol
+
+	// limit the time of the TLS handshake and the authentication, so
+	// clients cannot stall the listener before they are authenticated
+	if err := s.conn.SetDeadline(time.Now().Add(authTimeout)); err != nil {
+		logError("client:", err)
+		return
+	}
+	if c, ok := s.conn.(*tls.Conn); ok {
+		if err := c.Handshake(); err != nil {
+			logError("client:", err)
+			return
+		}
+	}
 
 	// send welcome message to client
-	s.sendEarly(fmt.Sprintf("info: Welcome to nuqql-mattermostd v%s!\r\n",
-		backendVersion))
-	s.sendEarly("info: Enter \"help\" for a list of available commands " +
-		"and their help texts\r\n")
+	s.sendEarly(newInfoMessage(fmt.Sprintf(
+		"Welcome to nuqql-mattermostd v%s!", backendVersion)))
+	s.sendEarly(newInfoMessage("Enter \"help\" for a list of available " +
+		"commands and their help texts"))
+
+	// if authentication is enabled, the client must authenticate before
+	// it gets access to accounts and messages
+	r := bufio.NewReader(s.conn)
+	if s.authSecret != "" && !s.authenticate(r) {
+		return
+	}
+	if err := s.conn.SetDeadline(time.Time{}); err != nil {
+		logError("client:", err)
+		return
+	}
+
+	// only one authenticated client connection is allowed at the same
+	// time on all listeners
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
 
 	// if push accounts is enabled, send list of accounts to client
 	if conf.PushAccounts {
-		s.sendEarly("info: Listing your accounts:\r\n")
-		s.sendEarly(s.getAccountListMessages())
+		s.sendEarly(newInfoMessage("Listing your accounts:"))
+		for _, m := range s.getAccountListMessages() {
+			s.sendEarly(m)
+		}
 	}
 
 	// configure client in queue
+	clientQueue.setProtocol(s.protocol)
 	clientQueue.setClient(s.conn)
 	defer clientQueue.setClient(nil)
 
 	// enable client
+	metrics.add(metrics.clients, 1)
+	defer metrics.add(metrics.clients, -1)
 	s.clientActive = true
 
+	// cancel running commands and wait for them when the client is done
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		s.commands.Wait()
+		s.lastOrdered = nil
+	}()
+
 	// start client command handling loop
-	r := bufio.NewReader(s.conn)
-	c := ""
-	ctx := context.Background()
 	for s.clientActive {
 		// read a cmd line from the client
-		cmd, err := r.ReadString('\n')
+		cmd, err := s.readCommand(r)
 		if err != nil {
 			logError("client:", err)
 			return
 		}
-
-		// read and concatenate cmd lines until "\r\n"
-		c += cmd
-		if len(c) >= 2 && c[len(c)-2] == '\r' {
-			s.handleCommand(ctx, c[:len(c)-2])
-			c = ""
-		}
+		s.dispatchCommand(ctx, cmd)
 	}
 }
 
@@ -488,10 +1004,23 @@ func (s *server) run() {
 	}
 
 	// start listener
-	l, err := net.Listen(s.network, s.address)
+	l, err := listen(s.network, s.address)
 	if err != nil {
 		logFatal(err)
 	}
+	if s.network == "unix" {
+		// restrict access to the socket to the allowed users
+		if err := setSocketPermissions(s.address); err != nil {
+			logFatal(err)
+		}
+	}
+	if s.useTLS {
+		config, err := getServerTLSConfig()
+		if err != nil {
+			logFatal(err)
+		}
+		l = tls.NewListener(l, config)
+	}
 	defer func() {
 		if err := l.Close(); err != nil {
 			logError(err)
@@ -501,25 +1030,72 @@ func (s *server) run() {
 	s.serverActive = true
 
 	// handle client connections
-	logInfo("Server waiting for client connection")
+	logInfo("Server waiting for client connection on", s.network,
+		s.address)
 	for s.serverActive {
 		conn, err := s.listener.Accept()
 		if err != nil {
 			logError(err)
 			continue
 		}
+		if s.network == "unix" {
+			// only allow connections from allowed users
+			if err := checkPeer(conn); err != nil {
+				logWarn("Rejected client connection:", err)
+				if err := conn.Close(); err != nil {
+					logError(err)
+				}
+				continue
+			}
+		}
 		s.conn = conn
-
-		// only one client connection is allowed at the same time
 		s.handleClient()
 	}
 }
 
-// runServer runs the server that handles nuqql/telnet connections
+// newServer creates a new server for the listener l
+func newServer(l *Listener) (*server, error) {
+	switch l.Network {
+	case "tcp", "tcp6":
+	case "unix":
+		if l.TLS {
+			return nil, fmt.Errorf("TLS is not supported on unix " +
+				"listeners")
+		}
+	default:
+		return nil, fmt.Errorf("unknown listener network %s", l.Network)
+	}
+	protocol := l.Protocol
+	switch protocol {
+	case "":
+		protocol = protocolNuqql
+	case protocolNuqql, protocolJSON:
+	default:
+		return nil, fmt.Errorf("unknown listener protocol %s", protocol)
+	}
+	return &server{
+		network:      l.Network,
+		address:      l.Address,
+		useTLS:       l.TLS,
+		authSecret:   conf.GetAuthSecret(l),
+		initProtocol: protocol,
+	}, nil
+}
+
+// runServer runs the servers that handle nuqql/telnet connections on all
+// listeners until one of them is quit
 func runServer() {
-	server := server{
-		network: conf.GetListenNetwork(),
-		address: conf.GetListenAddress(),
+	listeners := conf.GetListeners()
+	done := make(chan struct{}, len(listeners))
+	for _, l := range listeners {
+		s, err := newServer(&l)
+		if err != nil {
+			logFatal(err)
+		}
+		go func() {
+			s.run()
+			done <- struct{}{}
+		}()
 	}
-	server.run()
+	<-done
 }
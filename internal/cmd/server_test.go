@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitCommandTag(t *testing.T) {
+	for _, test := range []struct {
+		line, tag, cmd string
+	}{
+		{"account list", "", "account list"},
+		{"#1 account list", "1", "account list"},
+		{"#abc version", "abc", "version"},
+		{"#abc", "abc", ""},
+	} {
+		tag, cmd := splitCommandTag(test.line)
+		if tag != test.tag || cmd != test.cmd {
+			t.Errorf("got %q %q, wanted %q %q", tag, cmd, test.tag,
+				test.cmd)
+		}
+	}
+}
+
+func TestGetCommandTag(t *testing.T) {
+	// test context without tag
+	want := ""
+	got := getCommandTag(context.Background())
+	if got != want {
+		t.Errorf("got %s, wanted %s", got, want)
+	}
+
+	// test context with tag
+	want = "test"
+	got = getCommandTag(withCommandTag(context.Background(), want))
+	if got != want {
+		t.Errorf("got %s, wanted %s", got, want)
+	}
+}
+
+func TestTagMessage(t *testing.T) {
+	msg := "info: line 1\r\ninfo: line 2\r\n"
+	want := "#1 info: line 1\r\n#1 info: line 2\r\n"
+	got := tagMessage("1", msg)
+	if got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+}
+
+func TestCheckAuthSecret(t *testing.T) {
+	s := &server{authSecret: "secret"}
+	for _, test := range []struct {
+		secret string
+		want   bool
+	}{
+		{"secret", true},
+		{"wrong", false},
+		{"", false},
+	} {
+		got := s.checkAuthSecret(test.secret)
+		if got != test.want {
+			t.Errorf("%s: got %t, wanted %t", test.secret, got,
+				test.want)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	for _, test := range []struct {
+		auth string
+		want bool
+		last string
+	}{
+		{"#2 auth secret\r\n", true, "#2 info: authenticated.\r\n"},
+		{"#2 auth wrong\r\n", false,
+			"#2 error: authentication failed\r\n"},
+	} {
+		client, conn := net.Pipe()
+		s := &server{conn: conn, protocol: protocolNuqql,
+			authSecret: "secret"}
+		done := make(chan bool)
+		go func() {
+			done <- s.authenticate(bufio.NewReader(conn))
+		}()
+
+		r := bufio.NewReader(client)
+		for _, c := range []struct {
+			cmd, want string
+		}{
+			{"", "error: authentication required"},
+			{"#1 account list\r\n", "#1 error: authentication " +
+				"required"},
+			{test.auth, test.last},
+		} {
+			if c.cmd != "" {
+				_, err := client.Write([]byte(c.cmd))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := r.ReadString('\n')
+			if err != nil || !strings.HasPrefix(got, c.want) {
+				t.Errorf("got %q, %v, wanted %q", got, err, c.want)
+			}
+		}
+		if got := <-done; got != test.want {
+			t.Errorf("got %t, wanted %t", got, test.want)
+		}
+		_ = client.Close()
+		_ = conn.Close()
+	}
+}
+
+func TestHandleClientAuthTimeout(t *testing.T) {
+	timeout := authTimeout
+	authTimeout = 100 * time.Millisecond
+	defer func() {
+		// cleanup
+		authTimeout = timeout
+	}()
+
+	// another client holds the client mutex, an unauthenticated client
+	// must not wait for it and time out
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+
+	client, conn := net.Pipe()
+	defer func() {
+		_ = client.Close()
+	}()
+	s := &server{conn: conn, initProtocol: protocolNuqql,
+		authSecret: "secret"}
+	done := make(chan struct{})
+	go func() {
+		s.handleClient()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not time out")
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	secret := conf.AuthSecret
+	defer func() {
+		// cleanup
+		conf.AuthSecret = secret
+	}()
+	conf.AuthSecret = "secret"
+
+	// test valid listeners
+	for _, test := range []struct {
+		l    Listener
+		want *server
+	}{
+		{Listener{Network: "tcp", Address: "localhost:32000"},
+			&server{network: "tcp", address: "localhost:32000",
+				authSecret: "secret", initProtocol: "nuqql"}},
+		{Listener{Network: "tcp6", Address: "[::1]:32000", TLS: true,
+			Protocol: "json", AuthSecret: "own"},
+			&server{network: "tcp6", address: "[::1]:32000",
+				useTLS: true, authSecret: "own",
+				initProtocol: "json"}},
+		{Listener{Network: "unix", Address: "/tmp/test.sock",
+			DisableAuth: true},
+			&server{network: "unix", address: "/tmp/test.sock",
+				initProtocol: "nuqql"}},
+	} {
+		s, err := newServer(&test.l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.network != test.want.network ||
+			s.address != test.want.address ||
+			s.useTLS != test.want.useTLS ||
+			s.authSecret != test.want.authSecret ||
+			s.initProtocol != test.want.initProtocol {
+			t.Errorf("got %+v, wanted %+v", s, test.want)
+		}
+	}
+
+	// test invalid listeners
+	for _, l := range []Listener{
+		{Network: "udp", Address: "localhost:32000"},
+		{Network: "unix", Address: "test.sock", TLS: true},
+		{Network: "tcp", Address: "localhost:32000", Protocol: "test"},
+	} {
+		if _, err := newServer(&l); err == nil {
+			t.Errorf("%v: got nil, wanted error", l)
+		}
+	}
+}
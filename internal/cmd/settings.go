@@ -0,0 +1,383 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	// settingDefault is the setting value that resets a setting to the
+	// global default
+	settingDefault = "default"
+)
+
+var (
+	// displayNames are the supported display name policies
+	displayNames = []string{
+		model.ShowUsername,
+		model.ShowNicknameFullName,
+		model.ShowFullName,
+	}
+
+	// accountSettingList contains all account settings that can be
+	// shown and set by the client
+	accountSettingList = []*accountSetting{
+		boolSetting("filter_own",
+			func(s *accountSettings) **bool { return &s.FilterOwn },
+			func(c *Config) bool { return c.FilterOwn }),
+		boolSetting("disable_history",
+			func(s *accountSettings) **bool {
+				return &s.DisableHistory
+			},
+			func(c *Config) bool { return c.DisableHistory }),
+		boolSetting("disable_encryption",
+			func(s *accountSettings) **bool {
+				return &s.DisableEncryption
+			},
+			func(c *Config) bool { return c.DisableEncryption }),
+		uintSetting("catch_up_limit",
+			func(s *accountSettings) **uint { return &s.CatchUpLimit },
+			func(c *Config) uint { return c.CatchUpLimit }),
+		stringSetting("display_name",
+			func(s *accountSettings) *string { return &s.DisplayName },
+			func(c *Config) string { return c.DisplayName },
+			checkDisplayName),
+		stringSetting("proxy",
+			func(s *accountSettings) *string { return &s.Proxy },
+			func(c *Config) string { return c.Proxy },
+			func(v string) error {
+				_, err := getProxy(v)
+				return err
+			}),
+		keywordsSetting(),
+		tlsSetting("tls_ca",
+			func(t *accountTLS) *string { return &t.CA }, nil),
+		tlsSetting("tls_cert",
+			func(t *accountTLS) *string { return &t.Cert }, nil),
+		tlsSetting("tls_key",
+			func(t *accountTLS) *string { return &t.Key }, nil),
+		tlsSetting("tls_min_version",
+			func(t *accountTLS) *string { return &t.MinVersion },
+			func(v string) error {
+				if _, ok := tlsVersions[v]; !ok {
+					return fmt.Errorf("unknown TLS version %s",
+						v)
+				}
+				return nil
+			}),
+		tlsPinsSetting(),
+	}
+)
+
+// accountSettings contains the settings of an account that override the
+// global settings; unset values use the global settings
+type accountSettings struct {
+	// FilterOwn toggles filtering of own messages
+	FilterOwn *bool `json:",omitempty"`
+	// DisableHistory disables the message history
+	DisableHistory *bool `json:",omitempty"`
+	// DisableEncryption disables TLS encryption if the server has no
+	// scheme
+	DisableEncryption *bool `json:",omitempty"`
+	// CatchUpLimit is the maximum number of old messages per chat that
+	// are retrieved on connect; 0 disables the limit
+	CatchUpLimit *uint `json:",omitempty"`
+	// DisplayName is the display name policy of message senders:
+	// username, nickname_full_name or full_name
+	DisplayName string `json:",omitempty"`
+	// Proxy is the proxy url of mattermost connections, see getProxy
+	Proxy string `json:",omitempty"`
+	// Keywords are the words that highlight messages
+	Keywords []string `json:",omitempty"`
+	// TLS contains the TLS settings of mattermost connections
+	TLS *accountTLS `json:",omitempty"`
+}
+
+// getSetting returns the value of the setting p or, if it is not set, def
+func getSetting[T any](p *T, def T) T {
+	if p != nil {
+		return *p
+	}
+	return def
+}
+
+// clientSettings contains the settings of a mattermost client with the
+// account settings applied to the global settings
+type clientSettings struct {
+	filterOwn         bool
+	disableHistory    bool
+	disableEncryption bool
+	catchUpLimit      uint
+	displayName       string
+	keywords          []string
+}
+
+// getClientSettings returns the settings of the mattermost client with the
+// global settings in c
+func (s *accountSettings) getClientSettings(c *Config) *clientSettings {
+	displayName := s.DisplayName
+	if displayName == "" {
+		displayName = c.DisplayName
+	}
+	keywords := s.Keywords
+	if keywords == nil {
+		keywords = c.Keywords
+	}
+	return &clientSettings{
+		filterOwn:      getSetting(s.FilterOwn, c.FilterOwn),
+		disableHistory: getSetting(s.DisableHistory, c.DisableHistory),
+		disableEncryption: getSetting(s.DisableEncryption,
+			c.DisableEncryption),
+		catchUpLimit: getSetting(s.CatchUpLimit, c.CatchUpLimit),
+		displayName:  displayName,
+		keywords:     slices.Clone(keywords),
+	}
+}
+
+// getProxy returns the proxy of the account settings; defaults to the global
+// proxy in c
+func (s *accountSettings) getProxy(c *Config) string {
+	if s.Proxy != "" {
+		return s.Proxy
+	}
+	return c.Proxy
+}
+
+// checkDisplayName checks if the display name policy v is supported
+func checkDisplayName(v string) error {
+	if !slices.Contains(displayNames, v) {
+		return fmt.Errorf("unknown display name policy %s, expected "+
+			"one of: %s", v, strings.Join(displayNames, ", "))
+	}
+	return nil
+}
+
+// accountSetting is an account setting that can be shown and set by the
+// client
+type accountSetting struct {
+	// key is the name of the setting, e.g., "filter_own"
+	key string
+
+	// get returns the value of the setting in s and whether it is set
+	get func(s *accountSettings) (string, bool)
+
+	// set sets the setting in s to value; the value "default" resets
+	// the setting to the global default
+	set func(s *accountSettings, value string) error
+
+	// def returns the global default of the setting in c
+	def func(c *Config) string
+}
+
+// boolSetting creates a boolean account setting with the key, the field of
+// the setting in the account settings and its global default
+func boolSetting(key string, field func(*accountSettings) **bool,
+	def func(*Config) bool) *accountSetting {
+
+	return &accountSetting{
+		key: key,
+		get: func(s *accountSettings) (string, bool) {
+			if p := *field(s); p != nil {
+				return strconv.FormatBool(*p), true
+			}
+			return "", false
+		},
+		set: func(s *accountSettings, value string) error {
+			if value == settingDefault {
+				*field(s) = nil
+				return nil
+			}
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value %s, expected "+
+					"true or false", value)
+			}
+			*field(s) = &b
+			return nil
+		},
+		def: func(c *Config) string {
+			return strconv.FormatBool(def(c))
+		},
+	}
+}
+
+// uintSetting creates an unsigned integer account setting with the key, the
+// field of the setting in the account settings and its global default
+func uintSetting(key string, field func(*accountSettings) **uint,
+	def func(*Config) uint) *accountSetting {
+
+	return &accountSetting{
+		key: key,
+		get: func(s *accountSettings) (string, bool) {
+			if p := *field(s); p != nil {
+				return strconv.FormatUint(uint64(*p), 10), true
+			}
+			return "", false
+		},
+		set: func(s *accountSettings, value string) error {
+			if value == settingDefault {
+				*field(s) = nil
+				return nil
+			}
+			u, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid value %s, expected "+
+					"a number", value)
+			}
+			v := uint(u)
+			*field(s) = &v
+			return nil
+		},
+		def: func(c *Config) string {
+			return strconv.FormatUint(uint64(def(c)), 10)
+		},
+	}
+}
+
+// stringSetting creates a string account setting with the key, the field of
+// the setting in the account settings, its global default and an optional
+// check of new values
+func stringSetting(key string, field func(*accountSettings) *string,
+	def func(*Config) string, check func(string) error) *accountSetting {
+
+	return &accountSetting{
+		key: key,
+		get: func(s *accountSettings) (string, bool) {
+			v := *field(s)
+			return v, v != ""
+		},
+		set: func(s *accountSettings, value string) error {
+			if value == settingDefault {
+				*field(s) = ""
+				return nil
+			}
+			if check != nil {
+				if err := check(value); err != nil {
+					return err
+				}
+			}
+			*field(s) = value
+			return nil
+		},
+		def: def,
+	}
+}
+
+// tlsSetting creates a string TLS setting with the key, the field of the
+// setting in the TLS settings and an optional check of new values; TLS
+// settings have no global default
+func tlsSetting(key string, field func(*accountTLS) *string,
+	check func(string) error) *accountSetting {
+
+	return &accountSetting{
+		key: key,
+		get: func(s *accountSettings) (string, bool) {
+			if s.TLS == nil || *field(s.TLS) == "" {
+				return "", false
+			}
+			return *field(s.TLS), true
+		},
+		set: func(s *accountSettings, value string) error {
+			if value == settingDefault {
+				if s.TLS != nil {
+					*field(s.TLS) = ""
+					s.compactTLS()
+				}
+				return nil
+			}
+			if check != nil {
+				if err := check(value); err != nil {
+					return err
+				}
+			}
+			if s.TLS == nil {
+				s.TLS = &accountTLS{}
+			}
+			*field(s.TLS) = value
+			return nil
+		},
+		def: func(*Config) string { return "" },
+	}
+}
+
+// tlsPinsSetting creates the TLS setting of the certificate pins; the pins
+// are separated by commas
+func tlsPinsSetting() *accountSetting {
+	return &accountSetting{
+		key: "tls_pins",
+		get: func(s *accountSettings) (string, bool) {
+			if s.TLS == nil || len(s.TLS.Pins) == 0 {
+				return "", false
+			}
+			return strings.Join(s.TLS.Pins, ","), true
+		},
+		set: func(s *accountSettings, value string) error {
+			if value == settingDefault {
+				if s.TLS != nil {
+					s.TLS.Pins = nil
+					s.compactTLS()
+				}
+				return nil
+			}
+			if s.TLS == nil {
+				s.TLS = &accountTLS{}
+			}
+			s.TLS.Pins = strings.Split(value, ",")
+			return nil
+		},
+		def: func(*Config) string { return "" },
+	}
+}
+
+// keywordsSetting creates the setting of the keywords that highlight
+// messages; the keywords are separated by commas
+func keywordsSetting() *accountSetting {
+	return &accountSetting{
+		key: "keywords",
+		get: func(s *accountSettings) (string, bool) {
+			if s.Keywords == nil {
+				return "", false
+			}
+			return strings.Join(s.Keywords, ","), true
+		},
+		set: func(s *accountSettings, value string) error {
+			if value == settingDefault {
+				s.Keywords = nil
+				return nil
+			}
+			s.Keywords = strings.Split(value, ",")
+			return nil
+		},
+		def: func(c *Config) string {
+			return strings.Join(c.Keywords, ",")
+		},
+	}
+}
+
+// compactTLS removes the TLS settings if they are empty
+func (s *accountSettings) compactTLS() {
+	t := s.TLS
+	if t.CA == "" && t.Cert == "" && t.Key == "" && t.MinVersion == "" &&
+		len(t.Pins) == 0 {
+		s.TLS = nil
+	}
+}
+
+// getAccountSetting returns the account setting identified by key
+func getAccountSetting(key string) (*accountSetting, error) {
+	for _, setting := range accountSettingList {
+		if setting.key == key {
+			return setting, nil
+		}
+	}
+	var keys []string
+	for _, setting := range accountSettingList {
+		keys = append(keys, setting.key)
+	}
+	return nil, fmt.Errorf("unknown setting %s, expected one of: %s", key,
+		strings.Join(keys, ", "))
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAccountSettingsGetProxy(t *testing.T) {
+	c := NewConfig("testConfig")
+	c.Proxy = "socks5://global:1080"
+
+	// test global proxy
+	s := &accountSettings{}
+	want := "socks5://global:1080"
+	got := s.getProxy(c)
+	if got != want {
+		t.Errorf("got %s, wanted %s", got, want)
+	}
+
+	// test account proxy
+	s.Proxy = proxyDirect
+	want = proxyDirect
+	got = s.getProxy(c)
+	if got != want {
+		t.Errorf("got %s, wanted %s", got, want)
+	}
+}
+
+func TestGetClientSettings(t *testing.T) {
+	c := NewConfig("testConfig")
+	c.FilterOwn = true
+	c.CatchUpLimit = 10
+	c.Keywords = []string{"foo"}
+
+	// test global settings
+	s := &accountSettings{}
+	got := s.getClientSettings(c)
+	if !got.filterOwn || got.disableHistory || got.catchUpLimit != 10 ||
+		got.displayName != "nickname_full_name" ||
+		!slices.Equal(got.keywords, []string{"foo"}) {
+		t.Errorf("got %+v, wanted global settings", got)
+	}
+
+	// test account settings
+	filterOwn, disableHistory, limit := false, true, uint(0)
+	s = &accountSettings{
+		FilterOwn:      &filterOwn,
+		DisableHistory: &disableHistory,
+		CatchUpLimit:   &limit,
+		DisplayName:    "username",
+		Keywords:       []string{"bar", "baz"},
+	}
+	got = s.getClientSettings(c)
+	if got.filterOwn || !got.disableHistory || got.catchUpLimit != 0 ||
+		got.displayName != "username" ||
+		!slices.Equal(got.keywords, []string{"bar", "baz"}) {
+		t.Errorf("got %+v, wanted account settings", got)
+	}
+}
+
+func TestAccountSettingSet(t *testing.T) {
+	c := NewConfig("testConfig")
+	c.Keywords = []string{"foo", "bar"}
+	for _, test := range []struct {
+		key, value, def string
+	}{
+		{"filter_own", "true", "false"},
+		{"disable_history", "false", "false"},
+		{"disable_encryption", "true", "false"},
+		{"catch_up_limit", "50", "0"},
+		{"display_name", "full_name", "nickname_full_name"},
+		{"proxy", "http://proxy:3128", ""},
+		{"keywords", "deploy,outage", "foo,bar"},
+		{"tls_ca", "ca.pem", ""},
+		{"tls_cert", "cert.pem", ""},
+		{"tls_key", "key.pem", ""},
+		{"tls_min_version", "1.3", ""},
+		{"tls_pins", "abc,def", ""},
+	} {
+		setting, err := getAccountSetting(test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := &accountSettings{}
+
+		// test unset setting
+		if v, ok := setting.get(s); ok || v != "" {
+			t.Errorf("%s: got %s %t, wanted unset", test.key, v, ok)
+		}
+		if v := setting.def(c); v != test.def {
+			t.Errorf("%s: got %s, wanted %s", test.key, v, test.def)
+		}
+
+		// test set setting
+		if err := setting.set(s, test.value); err != nil {
+			t.Fatal(err)
+		}
+		if v, ok := setting.get(s); !ok || v != test.value {
+			t.Errorf("%s: got %s %t, wanted %s", test.key, v, ok,
+				test.value)
+		}
+
+		// test reset setting
+		if err := setting.set(s, settingDefault); err != nil {
+			t.Fatal(err)
+		}
+		if v, ok := setting.get(s); ok || v != "" {
+			t.Errorf("%s: got %s %t, wanted unset", test.key, v, ok)
+		}
+		if s.TLS != nil {
+			t.Errorf("%s: got %+v, wanted nil TLS", test.key, s.TLS)
+		}
+	}
+}
+
+func TestAccountSettingSetInvalid(t *testing.T) {
+	for _, test := range []struct {
+		key, value string
+	}{
+		{"filter_own", "maybe"},
+		{"catch_up_limit", "-1"},
+		{"display_name", "nickname"},
+		{"proxy", "ftp://proxy"},
+		{"tls_min_version", "2.0"},
+	} {
+		setting, err := getAccountSetting(test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := setting.set(&accountSettings{}, test.value); err == nil {
+			t.Errorf("%s %s: got nil, wanted error", test.key,
+				test.value)
+		}
+	}
+
+	// test unknown setting
+	if _, err := getAccountSetting("unknown"); err == nil {
+		t.Errorf("got nil, wanted error")
+	}
+}
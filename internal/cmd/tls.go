@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var (
+	// tlsVersions maps TLS version names to TLS versions
+	tlsVersions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+)
+
+// accountTLS contains the TLS settings of the mattermost connections of an
+// account; files are relative to the working directory
+type accountTLS struct {
+	// CA is the file with the CA certificates that verify the server
+	// certificate; empty uses the system CA certificates
+	CA string `json:",omitempty"`
+	// Cert is the client certificate file
+	Cert string `json:",omitempty"`
+	// Key is the client key file
+	Key string `json:",omitempty"`
+	// MinVersion is the minimum TLS version: 1.0, 1.1, 1.2 or 1.3
+	MinVersion string `json:",omitempty"`
+	// Pins are the base64 encoded SHA-256 hashes of the subject public
+	// key info of accepted server certificates, optionally prefixed
+	// with "sha256//"; empty disables certificate pinning
+	Pins []string `json:",omitempty"`
+}
+
+// getTLSFile returns the path of the TLS file relative to the working
+// directory
+func getTLSFile(file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(conf.Dir, file)
+}
+
+// getSPKIHash returns the base64 encoded SHA-256 hash of the subject public
+// key info of cert
+func getSPKIHash(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// verifyPins returns a function that checks if a certificate in a verified
+// chain of the server matches one of the pins; other certificates sent by
+// the server are not checked, so they cannot satisfy a pin
+func verifyPins(pins []string) func(tls.ConnectionState) error {
+	hashes := make([]string, len(pins))
+	for i, p := range pins {
+		hashes[i] = strings.TrimPrefix(p, "sha256//")
+	}
+	return func(cs tls.ConnectionState) error {
+		for _, chain := range cs.VerifiedChains {
+			for _, cert := range chain {
+				if slices.Contains(hashes, getSPKIHash(cert)) {
+					return nil
+				}
+			}
+		}
+		return errors.New("server certificate does not match pins")
+	}
+}
+
+// getConfig returns the TLS configuration of the mattermost connections;
+// if t is nil, it returns nil to use the default configuration
+func (t *accountTLS) getConfig() (*tls.Config, error) {
+	if t == nil {
+		return nil, nil
+	}
+	config := &tls.Config{}
+
+	// verify server certificate with CA certificates
+	if t.CA != "" {
+		file := getTLSFile(t.CA)
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s",
+				file)
+		}
+		config.RootCAs = pool
+	}
+
+	// present client certificate
+	if t.Cert != "" || t.Key != "" {
+		cert, err := tls.LoadX509KeyPair(getTLSFile(t.Cert),
+			getTLSFile(t.Key))
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	// set minimum TLS version
+	if t.MinVersion != "" {
+		version, ok := tlsVersions[t.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %s",
+				t.MinVersion)
+		}
+		config.MinVersion = version
+	}
+
+	// check certificate pins
+	if len(t.Pins) > 0 {
+		config.VerifyConnection = verifyPins(t.Pins)
+	}
+	return config, nil
+}
+
+// getServerTLSConfig returns the TLS configuration of the server with the
+// certificate and key files in the working directory; if a client CA file
+// is configured, clients must present a certificate signed by it
+func getServerTLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(filepath.Join(conf.Dir, conf.TLSCert),
+		filepath.Join(conf.Dir, conf.TLSKey))
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if conf.TLSClientCA == "" {
+		return config, nil
+	}
+
+	// verify client certificates
+	file := filepath.Join(conf.Dir, conf.TLSClientCA)
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	return config, nil
+}
@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestCert returns a self-signed test certificate for localhost and its
+// key
+func newTestCert(t *testing.T) ([]byte, *ecdsa.PrivateKey) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl,
+		&k.PublicKey, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der, k
+}
+
+// writeTestCert writes a self-signed test certificate and its key to the
+// files cert and key in dir
+func writeTestCert(t *testing.T, dir, cert, key string) {
+	der, k := newTestCert(t)
+	keyDer, err := x509.MarshalECPrivateKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, block := range map[string]*pem.Block{
+		cert: {Type: "CERTIFICATE", Bytes: der},
+		key:  {Type: "EC PRIVATE KEY", Bytes: keyDer},
+	} {
+		err := os.WriteFile(filepath.Join(dir, file),
+			pem.EncodeToMemory(block), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetServerTLSConfig(t *testing.T) {
+	c := *conf
+	defer func() {
+		// cleanup
+		*conf = c
+	}()
+	conf.Dir = t.TempDir()
+	conf.TLSCert = "cert.pem"
+	conf.TLSKey = "key.pem"
+	conf.TLSClientCA = ""
+
+	// test missing certificate
+	if _, err := getServerTLSConfig(); err == nil {
+		t.Errorf("got nil, wanted error")
+	}
+
+	// test without client certificate verification
+	writeTestCert(t, conf.Dir, conf.TLSCert, conf.TLSKey)
+	config, err := getServerTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Certificates) != 1 ||
+		config.ClientAuth != tls.NoClientCert {
+		t.Errorf("got %d %v, wanted 1 %v", len(config.Certificates),
+			config.ClientAuth, tls.NoClientCert)
+	}
+
+	// test with client certificate verification
+	conf.TLSClientCA = conf.TLSCert
+	config, err = getServerTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientCAs == nil ||
+		config.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("got %v, wanted %v", config.ClientAuth,
+			tls.RequireAndVerifyClientCert)
+	}
+
+	// test invalid client ca file
+	conf.TLSClientCA = conf.TLSKey
+	if _, err := getServerTLSConfig(); err == nil {
+		t.Errorf("got nil, wanted error")
+	}
+}
+
+func TestAccountTLSGetConfig(t *testing.T) {
+	dir := conf.Dir
+	defer func() {
+		// cleanup
+		conf.Dir = dir
+	}()
+	conf.Dir = t.TempDir()
+	writeTestCert(t, conf.Dir, "cert.pem", "key.pem")
+
+	// test nil settings
+	var a *accountTLS
+	if config, err := a.getConfig(); config != nil || err != nil {
+		t.Errorf("got %v, %v, wanted nil, nil", config, err)
+	}
+
+	// test valid settings
+	a = &accountTLS{
+		CA:         "cert.pem",
+		Cert:       "cert.pem",
+		Key:        filepath.Join(conf.Dir, "key.pem"),
+		MinVersion: "1.3",
+		Pins:       []string{"test"},
+	}
+	config, err := a.getConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.RootCAs == nil || len(config.Certificates) != 1 ||
+		config.MinVersion != tls.VersionTLS13 ||
+		config.VerifyConnection == nil {
+		t.Errorf("got %+v, wanted CA, certificate, version and pins",
+			config)
+	}
+
+	// test invalid settings
+	for _, a := range []*accountTLS{
+		{CA: "missing.pem"},
+		{CA: "key.pem"},
+		{Cert: "cert.pem"},
+		{MinVersion: "2.0"},
+	} {
+		if _, err := a.getConfig(); err == nil {
+			t.Errorf("%+v: got nil, wanted error", a)
+		}
+	}
+}
+
+func TestVerifyPins(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(
+		func(_ http.ResponseWriter, _ *http.Request) {}))
+	defer s.Close()
+	hash := getSPKIHash(s.Certificate())
+
+	for _, test := range []struct {
+		pins []string
+		ok   bool
+	}{
+		{[]string{hash}, true},
+		{[]string{"other", "sha256//" + hash}, true},
+		{[]string{"other"}, false},
+	} {
+		config := s.Client().Transport.(*http.Transport).TLSClientConfig
+		config.VerifyConnection = verifyPins(test.pins)
+		resp, err := s.Client().Get(s.URL)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		if (err == nil) != test.ok {
+			t.Errorf("%v: got %v, wanted ok %t", test.pins, err,
+				test.ok)
+		}
+		s.Client().CloseIdleConnections()
+	}
+}
+
+func TestVerifyPinsUnverifiedCert(t *testing.T) {
+	// server with a valid certificate that also sends another
+	// certificate that is not in its verified chain
+	der, key := newTestCert(t)
+	other, _ := newTestCert(t)
+	s := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(_ http.ResponseWriter, _ *http.Request) {}))
+	s.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{der, other},
+			PrivateKey:  key,
+		}},
+	}
+	s.StartTLS()
+	defer s.Close()
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCert, err := x509.ParseCertificate(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	for _, test := range []struct {
+		pin string
+		ok  bool
+	}{
+		{getSPKIHash(cert), true},
+		{getSPKIHash(otherCert), false},
+	} {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:          pool,
+				VerifyConnection: verifyPins([]string{test.pin}),
+			},
+		}}
+		resp, err := client.Get(s.URL)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got %v, wanted ok %t", test.pin, err,
+				test.ok)
+		}
+		client.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// websocketEventChannelViewed is the websocket event older servers send if
+// the user viewed a channel, e.g., on another device; newer servers send
+// model.WebsocketEventMultipleChannelsViewed
+const websocketEventChannelViewed model.WebsocketEventType = "channel_viewed"
+
+// unreadCount stores the number of unread messages and mentions in a channel
+type unreadCount struct {
+	msgs     int64
+	mentions int64
+}
+
+// unreadCounts stores the unread counts of joined channels
+type unreadCounts struct {
+	mutex  sync.Mutex
+	counts map[string]unreadCount
+}
+
+// set replaces all unread counts with counts
+func (u *unreadCounts) set(counts map[string]unreadCount) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.counts = counts
+}
+
+// get returns the unread count of the channel identified by chanID
+func (u *unreadCounts) get(chanID string) unreadCount {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.counts[chanID]
+}
+
+// add adds an unread message to the channel identified by chanID; if mention
+// is set, the message is also counted as a mention
+func (u *unreadCounts) add(chanID string, mention bool) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	c := u.counts[chanID]
+	c.msgs++
+	if mention {
+		c.mentions++
+	}
+	u.counts[chanID] = c
+}
+
+// clear resets the unread count of the channel identified by chanID
+func (u *unreadCounts) clear(chanID string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	delete(u.counts, chanID)
+}
+
+// newUnreadCounts creates new unread counts
+func newUnreadCounts() *unreadCounts {
+	return &unreadCounts{
+		counts: make(map[string]unreadCount),
+	}
+}
+
+// getUnreadCounts returns the unread counts of channels from the channel
+// members of the user
+func getUnreadCounts(channels []*model.Channel,
+	members model.ChannelMembers) map[string]unreadCount {
+
+	counts := make(map[string]unreadCount)
+	for _, member := range members {
+		i := slices.IndexFunc(channels, func(c *model.Channel) bool {
+			return c.Id == member.ChannelId
+		})
+		if i == -1 {
+			continue
+		}
+		c := unreadCount{
+			msgs:     channels[i].TotalMsgCount - member.MsgCount,
+			mentions: member.MentionCount,
+		}
+		if c.msgs < 0 {
+			c.msgs = 0
+		}
+		if c.msgs > 0 || c.mentions > 0 {
+			counts[member.ChannelId] = c
+		}
+	}
+	return counts
+}
+
+// getPostedMentions returns the ids of the users mentioned in the posted
+// event or nil if they are not available; the server omits the mentions if
+// no user is mentioned
+func getPostedMentions(event *model.WebSocketEvent) []string {
+	ids := []string{}
+	mentions, ok := event.GetData()["mentions"].(string)
+	if !ok {
+		return ids
+	}
+	if err := json.Unmarshal([]byte(mentions), &ids); err != nil {
+		logError(err)
+		return nil
+	}
+	return ids
+}
+
+// isMention checks if the posted event mentions the user identified by
+// userID; every message in a direct channel counts as a mention
+func isMention(event *model.WebSocketEvent, userID string) bool {
+	if event.GetData()["channel_type"] ==
+		string(model.ChannelTypeDirect) {
+		return true
+	}
+	return slices.Contains(getPostedMentions(event), userID)
+}
+
+// getViewedChannels returns the ids of the channels in the channel viewed
+// event
+func getViewedChannels(event *model.WebSocketEvent) []string {
+	data := event.GetData()
+	if id, ok := data["channel_id"].(string); ok {
+		return []string{id}
+	}
+	var ids []string
+	times, _ := data["channel_times"].(map[string]any)
+	for id := range times {
+		ids = append(ids, id)
+	}
+	return ids
+}
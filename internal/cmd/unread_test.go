@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+func TestUnreadCounts(t *testing.T) {
+	u := newUnreadCounts()
+
+	// test adding messages and mentions
+	u.add("chan1", false)
+	u.add("chan1", true)
+	want := unreadCount{msgs: 2, mentions: 1}
+	if got := u.get("chan1"); got != want {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+
+	// test clearing counts
+	u.clear("chan1")
+	want = unreadCount{}
+	if got := u.get("chan1"); got != want {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+func TestGetUnreadCounts(t *testing.T) {
+	channels := []*model.Channel{
+		{Id: "chan1", TotalMsgCount: 10},
+		{Id: "chan2", TotalMsgCount: 5},
+		{Id: "chan3", TotalMsgCount: 7},
+	}
+	members := model.ChannelMembers{
+		{ChannelId: "chan1", MsgCount: 7, MentionCount: 2},
+		{ChannelId: "chan2", MsgCount: 5},
+		{ChannelId: "chan3", MsgCount: 8},
+		{ChannelId: "unknown", MsgCount: 1},
+	}
+	want := map[string]unreadCount{
+		"chan1": {msgs: 3, mentions: 2},
+	}
+	got := getUnreadCounts(channels, members)
+	if len(got) != len(want) || got["chan1"] != want["chan1"] {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+func TestIsMention(t *testing.T) {
+	for _, test := range []struct {
+		data map[string]any
+		want bool
+	}{
+		{map[string]any{"channel_type": "D"}, true},
+		{map[string]any{"channel_type": "O"}, false},
+		{map[string]any{"mentions": `["user1","user2"]`}, true},
+		{map[string]any{"mentions": `["user2"]`}, false},
+		{map[string]any{"mentions": `invalid`}, false},
+	} {
+		event := model.NewWebSocketEvent(model.WebsocketEventPosted,
+			"", "", "", nil, "")
+		event = event.SetData(test.data)
+		if got := isMention(event, "user1"); got != test.want {
+			t.Errorf("%v: got %t, wanted %t", test.data, got,
+				test.want)
+		}
+	}
+}
+
+func TestGetViewedChannels(t *testing.T) {
+	// test single channel
+	event := model.NewWebSocketEvent(websocketEventChannelViewed,
+		"", "", "", nil, "")
+	event = event.SetData(map[string]any{"channel_id": "chan1"})
+	want := []string{"chan1"}
+	if got := getViewedChannels(event); !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+
+	// test multiple channels
+	event = model.NewWebSocketEvent(
+		model.WebsocketEventMultipleChannelsViewed,
+		"", "", "", nil, "")
+	event = event.SetData(map[string]any{"channel_times": map[string]any{
+		"chan1": 1, "chan2": 2}})
+	want = []string{"chan1", "chan2"}
+	got := getViewedChannels(event)
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}